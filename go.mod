@@ -4,6 +4,8 @@ go 1.18
 
 require (
 	fyne.io/fyne/v2 v2.4.5
+	github.com/fsnotify/fsnotify v1.6.0
+	go.starlark.net v0.0.0-20231101134539-556fd59b42f6
 	golang.org/x/sys v0.20.0
 )
 
@@ -11,7 +13,6 @@ require (
 	fyne.io/systray v1.10.1-0.20231115130155-104f5ef7839e // indirect
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/fredbi/uri v1.0.0 // indirect
-	github.com/fsnotify/fsnotify v1.6.0 // indirect
 	github.com/fyne-io/gl-js v0.0.0-20220119005834-d2da28d9ccfe // indirect
 	github.com/fyne-io/glfw-js v0.0.0-20220120001248-ee7290d23504 // indirect
 	github.com/fyne-io/image v0.0.0-20220602074514-4956b0afb3d2 // indirect
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// 游戏函数地址
+const (
+	addPlantFunc  = 0x40D120 // Board::AddPlant
+	addZombieFunc = 0x42A0F0 // Challenge::PutZombieInRow
+	plantDieFunc  = 0x4679B0 // Plant::Die, 参数为植物地址
+	zombieDieFunc = 0x530170 // Zombie::DieNoLoot, ecx为僵尸地址
+	// Board中Challenge的偏移
+	boardChallengeOffset = 0x160
+)
+
+// 棋盘列数
+const boardCols = 9
+
+// 每次远程调用最多移除的对象数, 避免代码超出缓冲区
+const removeBatch = 64
+
+// @title: Actions
+// @description: 通过调用游戏函数或修改对象来操作当前关卡
+type Actions struct {
+	memory WritableMemory
+	// 远程调用游戏函数
+	call func(c *Code)
+}
+
+// @title: NewActions
+// @description: 操作当前连接的游戏
+// @return: *Actions
+func NewActions() *Actions {
+	return &Actions{memory: pvz, call: func(c *Code) { asm_code_inject(c, pvz.ProcessHandle) }}
+}
+
+// board 读取棋盘, 只能在战斗中操作
+func (a *Actions) board() (*Board, error) {
+	if ui, err := a.memory.ReadBytes(4, lawnAppBase, lawnAppGameUIOffset); err != nil {
+		return nil, err
+	} else if GameUI(readInt32(ui, 0)) != GameUIPlaying {
+		return nil, errors.New("只能在关卡中操作")
+	}
+	return ReadBoard(a.memory)
+}
+
+// checkCell 检查格子是否在棋盘内
+func checkCell(board *Board, row, col int) error {
+	if rows := board.Scene.Rows(); row < 0 || row >= rows {
+		return fmt.Errorf("行 %d 超出范围 0-%d", row, rows-1)
+	}
+	if col < 0 || col >= boardCols {
+		return fmt.Errorf("列 %d 超出范围 0-%d", col, boardCols-1)
+	}
+	return nil
+}
+
+// @title: Actions::PlacePlant
+// @description: 在格子中种植植物
+// @param: row int 行, 从0开始
+// @param: col int 列, 从0开始
+// @param: t PlantType 植物类型
+// @return: error
+func (a *Actions) PlacePlant(row, col int, t PlantType) error {
+	board, err := a.board()
+	if err != nil {
+		return err
+	}
+	if err := checkCell(board, row, col); err != nil {
+		return err
+	}
+	if _, ok := version_profile.Plants[int32(t)]; !ok {
+		return fmt.Errorf("未知的植物 %d", int32(t))
+	}
+
+	cd := newCode()
+	asm_push(cd, int32(-1))
+	asm_push(cd, int32(t))
+	asm_mov_exx(cd, EAX, int32(row))
+	asm_push(cd, int32(col))
+	asm_mov_exx_dword_ptr(cd, EBP, lawnAppBase)
+	asm_mov_exx_dword_ptr_exx_add(cd, EBP, lawnAppBoardOffset)
+	asm_push_exx(cd, EBP)
+	asm_call(cd, addPlantFunc)
+	asm_ret(cd)
+	a.call(cd)
+	return nil
+}
+
+// @title: Actions::ShovelPlant
+// @description: 铲除格子中的所有植物(包括南瓜头和睡莲)
+// @param: row int 行
+// @param: col int 列
+// @return: int 铲除的数量, error
+func (a *Actions) ShovelPlant(row, col int) (int, error) {
+	board, err := a.board()
+	if err != nil {
+		return 0, err
+	}
+	if err := checkCell(board, row, col); err != nil {
+		return 0, err
+	}
+	return a.removePlants(func(p Plant) bool {
+		return int(p.Row) == row && int(p.Col) == col
+	})
+}
+
+// @title: Actions::SpawnZombie
+// @description: 在指定行生成僵尸
+// @param: row int 行
+// @param: col int 列, 9为屏幕右侧
+// @param: t ZombieType 僵尸类型
+// @return: error
+func (a *Actions) SpawnZombie(row, col int, t ZombieType) error {
+	board, err := a.board()
+	if err != nil {
+		return err
+	}
+	// 僵尸可以在屏幕右侧外生成
+	if err := checkCell(board, row, 0); err != nil {
+		return err
+	}
+	if col < 0 || col > boardCols {
+		return fmt.Errorf("列 %d 超出范围 0-%d", col, boardCols)
+	}
+	if _, ok := version_profile.Zombies[int32(t)]; !ok {
+		return fmt.Errorf("未知的僵尸 %d", int32(t))
+	}
+
+	cd := newCode()
+	asm_push(cd, int32(col))
+	asm_push(cd, int32(t))
+	asm_mov_exx(cd, EAX, int32(row))
+	asm_mov_exx_dword_ptr(cd, ECX, lawnAppBase)
+	asm_mov_exx_dword_ptr_exx_add(cd, ECX, lawnAppBoardOffset)
+	asm_mov_exx_dword_ptr_exx_add(cd, ECX, boardChallengeOffset)
+	asm_call(cd, addZombieFunc)
+	asm_ret(cd)
+	a.call(cd)
+	return nil
+}
+
+// @title: Actions::ClearZombies
+// @description: 移除所有僵尸
+// @return: int 移除的数量, error
+func (a *Actions) ClearZombies() (int, error) {
+	if _, err := a.board(); err != nil {
+		return 0, err
+	}
+	return a.removeItems(boardZombiesOffset, zombieSize, func(item []byte) bool {
+		return !decodeZombie(item).Dead
+	}, func(cd *Code, address uint32) {
+		asm_mov_exx(cd, ECX, address)
+		asm_call(cd, zombieDieFunc)
+	})
+}
+
+// @title: Actions::ClearPlants
+// @description: 铲除所有植物
+// @return: int 铲除的数量, error
+func (a *Actions) ClearPlants() (int, error) {
+	if _, err := a.board(); err != nil {
+		return 0, err
+	}
+	return a.removePlants(func(p Plant) bool { return true })
+}
+
+// removePlants 调用游戏函数移除符合条件的植物
+func (a *Actions) removePlants(match func(p Plant) bool) (int, error) {
+	return a.removeItems(boardPlantsOffset, plantSize, func(item []byte) bool {
+		p := decodePlant(item)
+		return !p.Dead && match(p)
+	}, func(cd *Code, address uint32) {
+		asm_push(cd, address)
+		asm_call(cd, plantDieFunc)
+	})
+}
+
+// removeItems 对对象数组中符合条件的对象生成移除的代码并远程调用, 返回移除的数量
+func (a *Actions) removeItems(offset, stride int, match func(item []byte) bool, remove func(cd *Code, address uint32)) (int, error) {
+	items, err := readDataArray(a.memory, offset, stride)
+	if err != nil {
+		return 0, err
+	}
+	pointer, err := a.memory.ReadBytes(4, lawnAppBase, lawnAppBoardOffset, offset)
+	if err != nil {
+		return 0, err
+	}
+	array := uint32(readInt32(pointer, 0))
+	addresses := []uint32{}
+	for _, item := range items {
+		if match(item.Data) {
+			addresses = append(addresses, array+uint32(item.Index*stride))
+		}
+	}
+	for start := 0; start < len(addresses); start += removeBatch {
+		end := start + removeBatch
+		if end > len(addresses) {
+			end = len(addresses)
+		}
+		cd := newCode()
+		for _, address := range addresses[start:end] {
+			remove(cd, address)
+		}
+		asm_ret(cd)
+		a.call(cd)
+	}
+	return len(addresses), nil
+}
+
+// newCode 创建远程调用的代码
+func newCode() *Code {
+	return &Code{
+		page:      256,
+		code:      make([]byte, 1024),
+		length:    0,
+		calls_pos: make([]uint16, 0),
+	}
+}
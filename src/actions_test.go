@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// newTestActions 操作内存镜像, 记录远程调用的代码
+func newTestActions(g *testGame) (*Actions, *[]*Code) {
+	calls := []*Code{}
+	return &Actions{memory: g, call: func(c *Code) { calls = append(calls, c) }}, &calls
+}
+
+// expectedCode 每个对象一段代码, 最后是ret
+func expectedCode(parts ...[]byte) []byte {
+	out := []byte{}
+	for _, p := range parts {
+		out = append(out, p...)
+	}
+	return append(out, 0xC3)
+}
+
+func pushCall(address, function uint32) []byte {
+	out := append([]byte{0x68}, ToBytes(address)...)
+	return append(append(out, 0xE8), ToBytes(function)...)
+}
+
+func movECXCall(address, function uint32) []byte {
+	out := append([]byte{0xB8 + ECX}, ToBytes(address)...)
+	return append(append(out, 0xE8), ToBytes(function)...)
+}
+
+func TestShovelPlant(t *testing.T) {
+	g := newTestGame()
+	g.addPlant(16, 2, 3, false) // 睡莲
+	g.addPlant(0, 2, 4, false)
+	g.addPlant(30, 2, 3, false) // 南瓜头
+	g.addPlant(1, 2, 3, true)
+	a, calls := newTestActions(g)
+
+	removed, err := a.ShovelPlant(2, 3)
+	if err != nil || removed != 2 {
+		t.Fatalf("ShovelPlant = %d, %v", removed, err)
+	}
+	if len(*calls) != 1 {
+		t.Fatalf("calls = %d", len(*calls))
+	}
+	want := expectedCode(pushCall(testPlantsArray, plantDieFunc), pushCall(testPlantsArray+2*plantSize, plantDieFunc))
+	if c := (*calls)[0]; !bytes.Equal(c.code[:c.length], want) {
+		t.Fatalf("code = % x\nwant % x", c.code[:c.length], want)
+	}
+
+	if _, err := a.ShovelPlant(5, 0); err == nil {
+		t.Fatal("expected error for a row outside the board")
+	}
+}
+
+func TestClearPlantsBatches(t *testing.T) {
+	g := newTestGame()
+	for i := 0; i < removeBatch+1; i++ {
+		g.addPlant(0, int32(i%5), int32(i%9), false)
+	}
+	a, calls := newTestActions(g)
+	removed, err := a.ClearPlants()
+	if err != nil || removed != removeBatch+1 {
+		t.Fatalf("ClearPlants = %d, %v", removed, err)
+	}
+	if len(*calls) != 2 {
+		t.Fatalf("calls = %d, want 2 batches", len(*calls))
+	}
+	want := expectedCode(pushCall(testPlantsArray+removeBatch*plantSize, plantDieFunc))
+	if c := (*calls)[1]; !bytes.Equal(c.code[:c.length], want) {
+		t.Fatalf("second batch = % x\nwant % x", c.code[:c.length], want)
+	}
+}
+
+func TestClearZombies(t *testing.T) {
+	g := newTestGame()
+	g.addZombie(0, 1, true)
+	g.addZombie(2, 3, false)
+	a, calls := newTestActions(g)
+
+	removed, err := a.ClearZombies()
+	if err != nil || removed != 1 || len(*calls) != 1 {
+		t.Fatalf("ClearZombies = %d, %v, %d calls", removed, err, len(*calls))
+	}
+	want := expectedCode(movECXCall(testZombiesArray+zombieSize, zombieDieFunc))
+	if c := (*calls)[0]; !bytes.Equal(c.code[:c.length], want) {
+		t.Fatalf("code = % x\nwant % x", c.code[:c.length], want)
+	}
+
+	// 不在关卡中时不操作
+	binary.LittleEndian.PutUint32(g.app[lawnAppGameUIOffset:], uint32(GameUIZombiesWon))
+	if _, err := a.ClearZombies(); err == nil || len(*calls) != 1 {
+		t.Fatalf("ClearZombies outside a level = %v, %d calls", err, len(*calls))
+	}
+}
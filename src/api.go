@@ -28,8 +28,29 @@ type (
 // 常量
 const (
 	PROCESS_ALL_ACCESS = 0x001F0FFF
+
+	MOD_ALT      = 0x0001
+	MOD_CONTROL  = 0x0002
+	MOD_SHIFT    = 0x0004
+	MOD_NOREPEAT = 0x4000
+	WM_HOTKEY    = 0x0312
+	PM_REMOVE    = 0x0001
 )
 
+type POINT struct {
+	X, Y LONG
+}
+
+type MSG struct {
+	Hwnd     HANDLE
+	Message  UINT
+	WParam   uintptr
+	LParam   uintptr
+	Time     DWORD
+	Pt       POINT
+	LPrivate DWORD
+}
+
 var (
 	kernel32 = syscall.NewLazyDLL("kernel32.dll")
 	user32   = syscall.NewLazyDLL("user32.dll")
@@ -47,6 +68,9 @@ var (
 	VirtualFreeExW            = kernel32.NewProc("VirtualFreeEx")
 	CreateRemoteThreadW       = kernel32.NewProc("CreateRemoteThread")
 	WaitForSingleObjectW      = kernel32.NewProc("WaitForSingleObject")
+	RegisterHotKeyW           = user32.NewProc("RegisterHotKey")
+	UnregisterHotKeyW         = user32.NewProc("UnregisterHotKey")
+	PeekMessageW              = user32.NewProc("PeekMessageW")
 )
 
 func FindWindow(className, windowName string) HANDLE {
@@ -208,3 +232,44 @@ func WaitForSingleObject(hHandle HANDLE, dwMilliseconds DWORD) DWORD {
 
 	return DWORD(r1)
 }
+
+// 热键已被其他程序注册时会失败, 因此返回错误而不是panic
+func RegisterHotKey(hWnd HANDLE, id int, fsModifiers UINT, vk UINT) error {
+	r1, _, err := RegisterHotKeyW.Call(
+		uintptr(hWnd),
+		uintptr(id),
+		uintptr(fsModifiers),
+		uintptr(vk),
+	)
+
+	if r1 == 0 {
+		return err
+	}
+
+	return nil
+}
+
+func UnregisterHotKey(hWnd HANDLE, id int) error {
+	r1, _, err := UnregisterHotKeyW.Call(
+		uintptr(hWnd),
+		uintptr(id),
+	)
+
+	if r1 == 0 {
+		return err
+	}
+
+	return nil
+}
+
+func PeekMessage(lpMsg *MSG, hWnd HANDLE, wMsgFilterMin UINT, wMsgFilterMax UINT, wRemoveMsg UINT) BOOL {
+	r1, _, _ := PeekMessageW.Call(
+		uintptr(unsafe.Pointer(lpMsg)),
+		uintptr(hWnd),
+		uintptr(wMsgFilterMin),
+		uintptr(wMsgFilterMax),
+		uintptr(wRemoveMsg),
+	)
+
+	return BOOL(r1)
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// 规则触发备份的最小间隔, 避免规则之间互相触发时不停备份
+const scriptBackupInterval = 10 * time.Second
+
+// 保留的规则日志行数
+const scriptLogLines = 100
+
+// @title: gameScriptHost
+// @description: 规则使用的游戏和备份功能
+type gameScriptHost struct {
+	lock        sync.Mutex
+	last_backup time.Time
+}
+
+func (h *gameScriptHost) State() map[string]interface{} {
+	running := pvz.IsValid()
+	state := map[string]interface{}{"running": running, "ui": pvz.GetGameUI(), "music": MusicNone}
+	// 关卡状态, 不在关卡中时为0
+	board := &Board{}
+	if running {
+		if id, err := music.Current(); err == nil {
+			state["music"] = id
+		}
+		if b, err := ReadBoard(pvz); err == nil {
+			board = b
+		}
+	}
+	state["level"] = board.Level
+	state["scene"] = int32(board.Scene)
+	state["sun"] = board.Sun
+	state["wave"] = board.Wave
+	state["total_waves"] = board.TotalWaves
+	state["game_mode"] = board.GameMode
+	state["plants"] = board.Plants
+	state["zombies"] = board.Zombies
+	state["elapsed"] = int64(board.Elapsed / time.Second)
+	return state
+}
+
+func (h *gameScriptHost) ReadInt32(address ...int) (int32, error) {
+	if !pvz.IsValid() {
+		return 0, errors.New("游戏未运行")
+	}
+	b, err := pvz.ReadBytes(4, address...)
+	if err != nil {
+		return 0, err
+	}
+	return readInt32(b, 0), nil
+}
+
+func (h *gameScriptHost) Do(action ScriptAction) error {
+	switch action.Type {
+	case "backup":
+		h.lock.Lock()
+		if time.Since(h.last_backup) < scriptBackupInterval {
+			h.lock.Unlock()
+			return errors.New("规则触发备份过于频繁")
+		}
+		h.last_backup = time.Now()
+		h.lock.Unlock()
+		backup_name, err := SaveAndBackup(TriggerScript)
+		if err != nil || action.Text == "" {
+			return err
+		}
+		return AnnotateBackup(backup_name, action.Text, "", nil)
+	case "play":
+		return music.Play(action.Music)
+	case "stop":
+		return music.Stop()
+	case "notify":
+		if notifier != nil {
+			notifier(fyne.NewNotification(action.Text, action.Content))
+		}
+		return nil
+	}
+	return fmt.Errorf("未知的动作 %s", action.Type)
+}
+
+// @title: ScriptEngine
+// @description: 加载规则脚本并在游戏事件发生时执行
+type ScriptEngine struct {
+	lock    sync.Mutex
+	host    ScriptHost
+	path    string
+	script  *Script
+	globals map[string]interface{}
+	logs    []string
+	// 日志变化时的回调
+	on_log func([]string)
+}
+
+var automation = NewScriptEngine(&gameScriptHost{})
+
+// @title: NewScriptEngine
+// @description: 创建规则引擎
+// @param: host ScriptHost 规则使用的游戏和备份功能
+// @return: *ScriptEngine
+func NewScriptEngine(host ScriptHost) *ScriptEngine {
+	return &ScriptEngine{host: host, globals: map[string]interface{}{}}
+}
+
+// @title: LoadScript
+// @description: 读取并解析规则脚本文件
+// @param: path string 文件路径
+// @return: *Script, error
+func LoadScript(path string) (*Script, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseScript(string(data))
+}
+
+// @title: ScriptEngine::Load
+// @description: 加载规则脚本, 路径为空时停用规则, 路径不变时不重新加载
+// @param: path string 文件路径
+// @return: error
+func (e *ScriptEngine) Load(path string) error {
+	e.lock.Lock()
+	if path == e.path && (path == "" || e.script != nil) {
+		e.lock.Unlock()
+		return nil
+	}
+	e.lock.Unlock()
+	return e.Reload(path)
+}
+
+// @title: ScriptEngine::Reload
+// @description: 重新加载规则脚本, 清空setvar设置的变量
+// @param: path string 文件路径
+// @return: error
+func (e *ScriptEngine) Reload(path string) error {
+	var script *Script
+	if path != "" {
+		s, err := LoadScript(path)
+		if err != nil {
+			e.lock.Lock()
+			e.path, e.script = path, nil
+			e.lock.Unlock()
+			e.logf("加载规则失败: %v", err)
+			return err
+		}
+		script = s
+	}
+	e.lock.Lock()
+	e.path, e.script = path, script
+	e.globals = map[string]interface{}{}
+	e.lock.Unlock()
+	if script != nil {
+		e.logf("已加载 %d 条规则: %s", len(script.Rules), path)
+	}
+	return nil
+}
+
+// @title: ScriptEngine::Rules
+// @description: 已加载的规则数量
+// @return: int
+func (e *ScriptEngine) Rules() int {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if e.script == nil {
+		return 0
+	}
+	return len(e.script.Rules)
+}
+
+// @title: ScriptEngine::Handle
+// @description: 对事件执行规则并执行产生的动作
+// @param: event GameEvent 事件
+func (e *ScriptEngine) Handle(event GameEvent) {
+	e.lock.Lock()
+	script := e.script
+	e.lock.Unlock()
+	if script == nil {
+		return
+	}
+	// 规则在锁外执行, 读取内存时不阻塞加载
+	e.lock.Lock()
+	globals := map[string]interface{}{}
+	for k, v := range e.globals {
+		globals[k] = v
+	}
+	e.lock.Unlock()
+	actions, errs := script.Run(e.host, event, globals)
+	e.lock.Lock()
+	if e.script == script {
+		e.globals = globals
+	}
+	e.lock.Unlock()
+
+	for _, err := range errs {
+		e.logf("%s: %v", event.Type, err)
+	}
+	for _, action := range actions {
+		if action.Type == "log" {
+			e.logf("%s", action.Text)
+			continue
+		}
+		if err := e.host.Do(action); err != nil {
+			e.logf("%s: %s 失败: %v", event.Type, action.Type, err)
+		}
+	}
+}
+
+// @title: ScriptEngine::Run
+// @description: 订阅游戏事件并执行规则, 返回停止函数
+// @param: bus *EventBus 事件总线
+// @return: func() 停止
+func (e *ScriptEngine) Run(bus *EventBus) func() {
+	events, unsubscribe := bus.Subscribe(64)
+	go func() {
+		for event := range events {
+			e.Handle(event)
+		}
+	}()
+	return unsubscribe
+}
+
+// @title: ScriptEngine::Logs
+// @description: 最近的规则日志
+// @return: []string
+func (e *ScriptEngine) Logs() []string {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return append([]string{}, e.logs...)
+}
+
+// @title: ScriptEngine::OnLog
+// @description: 设置日志变化时的回调
+// @param: f func([]string) 回调
+func (e *ScriptEngine) OnLog(f func([]string)) {
+	e.lock.Lock()
+	e.on_log = f
+	e.lock.Unlock()
+}
+
+func (e *ScriptEngine) logf(format string, args ...interface{}) {
+	line := time.Now().Format("15:04:05 ") + fmt.Sprintf(format, args...)
+	log.Println("[script]", line)
+	e.lock.Lock()
+	e.logs = append(e.logs, line)
+	if len(e.logs) > scriptLogLines {
+		e.logs = e.logs[len(e.logs)-scriptLogLines:]
+	}
+	logs := append([]string{}, e.logs...)
+	on_log := e.on_log
+	e.lock.Unlock()
+	if on_log != nil {
+		on_log(logs)
+	}
+}
+
+// @title: NewScriptTab
+// @description: 自动化规则页
+// @param: w fyne.Window 父窗口
+// @return: fyne.CanvasObject, func(Config) 配置变化时刷新
+func NewScriptTab(w fyne.Window) (fyne.CanvasObject, func(Config)) {
+	path_entry := widget.NewEntry()
+	path_entry.SetPlaceHolder("rules file, empty to disable")
+	status_label := widget.NewLabel("")
+	log_label := widget.NewLabel("")
+	log_label.Wrapping = fyne.TextWrapWord
+
+	update_status := func() {
+		if CurrentConfig().Script == "" {
+			status_label.SetText("disabled")
+		} else {
+			status_label.SetText(fmt.Sprintf("%d rules loaded", automation.Rules()))
+		}
+	}
+	refresh := func(c Config) {
+		path_entry.SetText(c.Script)
+		update_status()
+	}
+	refresh(CurrentConfig())
+	automation.OnLog(func(logs []string) {
+		log_label.SetText(strings.Join(logs, "\n"))
+		update_status()
+	})
+	log_label.SetText(strings.Join(automation.Logs(), "\n"))
+
+	save_button := widget.NewButton("save", func() {
+		if path_entry.Text != "" {
+			if _, err := LoadScript(path_entry.Text); err != nil {
+				dialog.NewInformation("Error", err.Error(), w).Show()
+				return
+			}
+		}
+		if err := UpdateConfig(func(c *Config) { c.Script = path_entry.Text }); err != nil {
+			dialog.NewInformation("Error", err.Error(), w).Show()
+		}
+	})
+	reload_button := widget.NewButton("reload", func() {
+		if err := automation.Reload(CurrentConfig().Script); err != nil {
+			dialog.NewInformation("Error", err.Error(), w).Show()
+		}
+		refresh(CurrentConfig())
+	})
+
+	return container.NewBorder(
+		container.NewVBox(
+			container.NewBorder(nil, nil, nil, container.NewHBox(save_button, reload_button), path_entry),
+			status_label,
+		),
+		nil, nil, nil,
+		container.NewVScroll(log_label),
+	), refresh
+}
@@ -0,0 +1,572 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// 备份目录
+var backup_path = DefaultConfig().BackupDir
+
+// 备份文件夹中保存备份信息的文件, 恢复时不会拷贝到存档目录
+const backupMetaFile = ".backup.json"
+
+// 备份文件夹名的格式, 同一秒内多次备份时带有序号
+const backupNameLayout = "2006.01.02 15-04-05"
+
+var backupNamePattern = regexp.MustCompile(`^\d{4}\.\d{2}\.\d{2} \d{2}-\d{2}-\d{2}( \(\d+\))?$`)
+
+// 备份触发方式
+const (
+	TriggerAuto   = "auto"   // 自动保存
+	TriggerManual = "manual" // 手动备份
+	TriggerEdit   = "edit"   // 修改存档前
+	TriggerSwitch = "switch" // 切换存档配置前
+	TriggerSave   = "save"   // 游戏写入存档后
+	TriggerScript = "script" // 自动化规则
+)
+
+// @title: BackupMeta
+// @description: 备份信息, 保存在备份文件夹中
+type BackupMeta struct {
+	// 创建时间
+	Created time.Time `json:"created"`
+	// 触发方式
+	Trigger string `json:"trigger"`
+	// 用户填写的名称、备注和标签
+	Label string   `json:"label,omitempty"`
+	Note  string   `json:"note,omitempty"`
+	Tags  []string `json:"tags,omitempty"`
+	// 固定的备份不会被自动删除
+	Pinned bool `json:"pinned,omitempty"`
+	// 备份时关卡存档所在的关卡
+	Level int `json:"level,omitempty"`
+	// 在关卡中备份时的棋盘状态
+	Board *Board `json:"board,omitempty"`
+	// 备份时各文件的大小和校验值
+	Files map[string]BackupFileMeta `json:"files"`
+}
+
+// @title: BackupFileMeta
+// @description: 备份中单个文件的校验信息
+type BackupFileMeta struct {
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// @title: BackupInfo
+// @description: 备份列表中的一项
+type BackupInfo struct {
+	Name    string    `json:"name"`
+	Created time.Time `json:"created"`
+	Trigger string    `json:"trigger,omitempty"`
+	Label   string    `json:"label,omitempty"`
+	Note    string    `json:"note,omitempty"`
+	Tags    []string  `json:"tags,omitempty"`
+	Pinned  bool      `json:"pinned,omitempty"`
+	Level   int       `json:"level,omitempty"`
+	Size    int64     `json:"size"`
+	Files   int       `json:"files"`
+	// 是否有校验信息, 旧版本创建的备份没有
+	HasMeta bool `json:"has_meta"`
+}
+
+// @title: BackupDir
+// @description: 备份名对应的文件夹
+// @param: name string 备份名
+// @return: string
+func BackupDir(name string) string {
+	return filepath.Join(backup_path, name)
+}
+
+// validBackupName 备份名只能是备份目录下的一级文件夹, 不能包含路径
+func validBackupName(name string) bool {
+	return name != "" && name != "." && name != ".." && filepath.Base(name) == name
+}
+
+// @title: CreateBackup
+// @description: 将当前存档拷贝到以当前时间命名的备份文件夹, 并写入备份信息
+// @param: trigger string 触发方式
+// @return: string 备份名, error
+func CreateBackup(trigger string) (string, error) {
+	backup_name, err := createBackup(trigger)
+	if err != nil {
+		Notify(NotifyBackupFailed, "Backup failed", err.Error())
+		game_events.Publish(NewGameEvent(EventBackupFailed, map[string]interface{}{"trigger": trigger, "error": err.Error()}))
+	} else {
+		Notify(NotifyBackup, "Backup completed", backup_name+" ("+trigger+")")
+		game_events.Publish(NewGameEvent(EventBackup, map[string]interface{}{"name": backup_name, "trigger": trigger}))
+	}
+	return backup_name, err
+}
+
+// createBackup 创建备份
+func createBackup(trigger string) (string, error) {
+	now := time.Now()
+	backup_name := now.Format(backupNameLayout)
+	// 同一秒内多次备份时加上序号
+	for i := 2; FileIsExisted(BackupDir(backup_name)); i++ {
+		backup_name = fmt.Sprintf("%s (%d)", now.Format(backupNameLayout), i)
+	}
+	backup_dir := BackupDir(backup_name)
+	if err := MakeDir(backup_dir); err != nil {
+		return "", err
+	}
+	if err := CopyDir(data_path, backup_dir); err != nil {
+		os.RemoveAll(backup_dir)
+		return "", err
+	}
+
+	meta := &BackupMeta{Created: now, Trigger: trigger, Files: map[string]BackupFileMeta{}}
+	files, err := listFiles(backup_dir)
+	if err != nil {
+		return backup_name, err
+	}
+	for name, size := range files {
+		sum, err := fileSHA256(filepath.Join(backup_dir, name))
+		if err != nil {
+			return backup_name, err
+		}
+		meta.Files[name] = BackupFileMeta{Size: size, SHA256: sum}
+	}
+	meta.Level = SnapshotLevel(backup_dir)
+	return backup_name, WriteBackupMeta(backup_name, meta)
+}
+
+// @title: SaveAndBackup
+// @description: 游戏在关卡中时先调用游戏保存, 再备份存档
+// @param: trigger string 触发方式
+// @return: string 备份名, error
+func SaveAndBackup(trigger string) (string, error) {
+	var board *Board
+	var save func()
+	if pvz.IsValid() && pvz.GetGameUI() == GameUIPlaying {
+		board, _ = ReadBoard(pvz)
+		// 调用游戏保存, 游戏保存后会暂停音乐, 由音乐控制恢复播放
+		save = func() { music.Preserve(pvz.CallSave) }
+	}
+	return saveAndBackup(trigger, board, save)
+}
+
+// saveAndBackup save不为nil时先调用save保存游戏, 再备份存档
+func saveAndBackup(trigger string, board *Board, save func()) (string, error) {
+	if save != nil {
+		// 游戏写入的存档已经包含在这次备份中, 不再触发存档备份
+		defer backup_index.PauseSave()()
+		save()
+	}
+	backup_name, err := CreateBackup(trigger)
+	if err != nil || board == nil {
+		return backup_name, err
+	}
+	return backup_name, updateBackupMeta(backup_name, func(meta *BackupMeta) {
+		meta.Board = board
+		meta.Level = int(board.Level)
+	})
+}
+
+// @title: AnnotateBackup
+// @description: 修改备份的名称、备注和标签
+// @param: name string 备份名
+// @param: label string 名称
+// @param: note string 备注
+// @param: tags []string 标签
+// @return: error
+func AnnotateBackup(name, label, note string, tags []string) error {
+	return updateBackupMeta(name, func(meta *BackupMeta) {
+		meta.Label = strings.TrimSpace(label)
+		meta.Note = strings.TrimSpace(note)
+		meta.Tags = tags
+	})
+}
+
+// @title: RenameBackup
+// @description: 修改备份显示的名称, 备份文件夹名不变
+// @param: name string 备份名
+// @param: label string 名称
+// @return: error
+func RenameBackup(name, label string) error {
+	return updateBackupMeta(name, func(meta *BackupMeta) {
+		meta.Label = strings.TrimSpace(label)
+	})
+}
+
+// @title: SetBackupPinned
+// @description: 固定或取消固定备份, 固定的备份不会被自动删除
+// @param: name string 备份名
+// @param: pinned bool
+// @return: error
+func SetBackupPinned(name string, pinned bool) error {
+	return updateBackupMeta(name, func(meta *BackupMeta) {
+		meta.Pinned = pinned
+	})
+}
+
+// updateBackupMeta 修改备份信息, 旧版本创建的备份没有备份信息时新建一个不含校验值的
+func updateBackupMeta(name string, update func(meta *BackupMeta)) error {
+	if name == "" || !IsDir(BackupDir(name)) {
+		return fmt.Errorf("备份 %s 不存在！", name)
+	}
+	meta, err := ReadBackupMeta(name)
+	if os.IsNotExist(err) {
+		meta = &BackupMeta{Created: time.Now()}
+		if fi, err := os.Stat(BackupDir(name)); err == nil {
+			meta.Created = fi.ModTime()
+		}
+	} else if err != nil {
+		return err
+	}
+	update(meta)
+	return WriteBackupMeta(name, meta)
+}
+
+// @title: DeleteBackups
+// @description: 删除指定的备份
+// @param: names []string 备份名
+// @return: error
+func DeleteBackups(names []string) error {
+	for _, name := range names {
+		if name == "" || !IsDir(BackupDir(name)) {
+			return fmt.Errorf("备份 %s 不存在！", name)
+		}
+		if err := os.RemoveAll(BackupDir(name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// @title: ParseTags
+// @description: 解析以逗号或空格分隔的标签, 去掉重复和开头的#
+// @param: s string
+// @return: []string
+func ParseTags(s string) []string {
+	tags := []string{}
+	seen := map[string]bool{}
+	for _, tag := range strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == '，' || unicode.IsSpace(r)
+	}) {
+		tag = strings.TrimPrefix(tag, "#")
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+	return tags
+}
+
+// @title: BackupInfo::Matches
+// @description: 检查备份是否符合搜索条件, 以#开头的词匹配标签, 其他词匹配名称、备注和触发方式, 不区分大小写
+// @param: query string 搜索条件
+// @return: bool
+func (b BackupInfo) Matches(query string) bool {
+	text := strings.ToLower(strings.Join([]string{b.Name, b.Label, b.Note, b.Trigger}, "\n"))
+	for _, word := range strings.Fields(strings.ToLower(query)) {
+		if strings.HasPrefix(word, "#") {
+			found := false
+			for _, tag := range b.Tags {
+				if strings.ToLower(tag) == word[1:] {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+		} else if !strings.Contains(text, word) {
+			return false
+		}
+	}
+	return true
+}
+
+// @title: FilterBackups
+// @description: 筛选符合搜索条件的备份
+// @param: backups []BackupInfo 备份列表
+// @param: query string 搜索条件
+// @return: []BackupInfo
+func FilterBackups(backups []BackupInfo, query string) []BackupInfo {
+	found := []BackupInfo{}
+	for _, b := range backups {
+		if b.Matches(query) {
+			found = append(found, b)
+		}
+	}
+	return found
+}
+
+// @title: ReadBackupMeta
+// @description: 读取备份信息
+// @param: name string 备份名
+// @return: *BackupMeta, error
+func ReadBackupMeta(name string) (*BackupMeta, error) {
+	return readBackupMetaIn(backup_path, name)
+}
+
+// readBackupMetaIn 读取指定备份目录下的备份信息
+func readBackupMetaIn(root, name string) (*BackupMeta, error) {
+	data, err := os.ReadFile(filepath.Join(root, name, backupMetaFile))
+	if err != nil {
+		return nil, err
+	}
+	meta := &BackupMeta{}
+	if err := json.Unmarshal(data, meta); err != nil {
+		return nil, err
+	}
+	return meta, nil
+}
+
+// @title: WriteBackupMeta
+// @description: 写入备份信息
+// @param: name string 备份名
+// @param: meta *BackupMeta 备份信息
+// @return: error
+func WriteBackupMeta(name string, meta *BackupMeta) error {
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(BackupDir(name), backupMetaFile), data, 0666)
+}
+
+// @title: ListBackups
+// @description: 列出所有备份, 最新的在前
+// @return: []BackupInfo, error
+func ListBackups() ([]BackupInfo, error) {
+	return listBackupsIn(backup_path)
+}
+
+// listBackupsIn 列出指定备份目录下的所有备份, 最新的在前
+func listBackupsIn(root string) ([]BackupInfo, error) {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return nil, err
+	}
+	backups := []BackupInfo{}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		if info, ok := readBackupInfo(root, entry.Name()); ok {
+			backups = append(backups, info)
+		}
+	}
+	sortBackups(backups)
+	return backups, nil
+}
+
+// readBackupInfo 读取单个备份的信息, 备份不存在时返回false
+// 既没有备份信息也不是以时间命名的文件夹(例如其他存档配置的备份目录)不是备份
+func readBackupInfo(root, name string) (BackupInfo, bool) {
+	fi, err := os.Stat(filepath.Join(root, name))
+	if err != nil || !fi.IsDir() {
+		return BackupInfo{}, false
+	}
+	info := BackupInfo{Name: name, Created: fi.ModTime()}
+	meta, err := readBackupMetaIn(root, name)
+	if err != nil && !backupNamePattern.MatchString(name) {
+		return BackupInfo{}, false
+	}
+	if err == nil {
+		info.HasMeta = true
+		info.Created = meta.Created
+		info.Trigger = meta.Trigger
+		info.Label = meta.Label
+		info.Note = meta.Note
+		info.Tags = meta.Tags
+		info.Pinned = meta.Pinned
+		info.Level = meta.Level
+	}
+	if files, err := listFiles(filepath.Join(root, name)); err == nil {
+		info.Files = len(files)
+		for _, size := range files {
+			info.Size += size
+		}
+	}
+	return info, true
+}
+
+// sortBackups 按创建时间排序, 最新的在前, 时间相同时按备份名排序
+func sortBackups(backups []BackupInfo) {
+	sort.SliceStable(backups, func(i, j int) bool {
+		if !backups[i].Created.Equal(backups[j].Created) {
+			return backups[i].Created.After(backups[j].Created)
+		}
+		return backups[i].Name > backups[j].Name
+	})
+}
+
+// @title: RestoreBackup
+// @description: 将备份中的所有文件恢复到存档目录
+// @param: name string 备份名
+// @return: error
+func RestoreBackup(name string) error {
+	if err := restoreBackup(name); err != nil {
+		Notify(NotifyRestore, "Restore failed", err.Error())
+		game_events.Publish(NewGameEvent(EventRestoreFailed, map[string]interface{}{"name": name, "error": err.Error()}))
+		return err
+	}
+	Notify(NotifyRestore, "Restore completed", name)
+	game_events.Publish(NewGameEvent(EventRestore, map[string]interface{}{"name": name}))
+	return nil
+}
+
+// restoreBackup 恢复备份
+func restoreBackup(name string) error {
+	if !validBackupName(name) || !IsDir(BackupDir(name)) {
+		return fmt.Errorf("备份 %s 不存在！", name)
+	}
+	files, err := listFiles(BackupDir(name))
+	if err != nil {
+		return err
+	}
+	names := []string{}
+	for file := range files {
+		names = append(names, file)
+	}
+	return RestoreFiles(BackupDir(name), data_path, names)
+}
+
+// @title: VerifyBackup
+// @description: 根据备份信息检查备份文件是否完整
+// @param: name string 备份名
+// @return: []string 发现的问题, error
+func VerifyBackup(name string) ([]string, error) {
+	meta, err := ReadBackupMeta(name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, errors.New("备份没有校验信息")
+		}
+		return nil, err
+	}
+	if meta.Files == nil {
+		return nil, errors.New("备份没有校验信息")
+	}
+	files, err := listFiles(BackupDir(name))
+	if err != nil {
+		return nil, err
+	}
+
+	problems := []string{}
+	for file, expect := range meta.Files {
+		size, ok := files[file]
+		if !ok {
+			problems = append(problems, "missing: "+file)
+			continue
+		}
+		sum, err := fileSHA256(filepath.Join(BackupDir(name), file))
+		if err != nil {
+			return nil, err
+		}
+		if size != expect.Size || sum != expect.SHA256 {
+			problems = append(problems, "changed: "+file)
+		}
+	}
+	for file := range files {
+		if _, ok := meta.Files[file]; !ok {
+			problems = append(problems, "unexpected: "+file)
+		}
+	}
+	sort.Strings(problems)
+	return problems, nil
+}
+
+// @title: PruneBackups
+// @description: 删除最旧的备份, 只保留指定数量, 固定的备份不计入数量也不会被删除
+// @param: keep int 保留数量
+// @return: []string 删除的备份名, error
+func PruneBackups(keep int) ([]string, error) {
+	backups, err := ListBackups()
+	if err != nil {
+		return nil, err
+	}
+	removed := []string{}
+	kept := 0
+	for _, b := range backups {
+		if b.Pinned {
+			continue
+		}
+		if kept < keep {
+			kept++
+			continue
+		}
+		if err := os.RemoveAll(BackupDir(b.Name)); err != nil {
+			return removed, err
+		}
+		removed = append(removed, b.Name)
+	}
+	return removed, nil
+}
+
+// 上次检查时游戏是否在运行, 用于通知游戏启动和退出
+var game_running = false
+
+// 监测协程、命令行和本地API都会连接游戏, 连接时修改pvz的句柄需要加锁
+var attach_lock sync.Mutex
+
+// @title: AttachGame
+// @description: 检查游戏是否在运行, 在运行且尚未连接时打开游戏进程
+// @return: bool 游戏是否在运行
+func AttachGame() bool {
+	attach_lock.Lock()
+	defer attach_lock.Unlock()
+	is_running := CheckWindowTitle(game_title)
+	if !pvz.IsValid() && pvz.ProcessHandle != 0 {
+		// 游戏已经退出, 关闭之前打开的进程句柄
+		CloseHandle(pvz.ProcessHandle)
+		pvz.Handle, pvz.Pid, pvz.ProcessHandle = 0, 0, 0
+	}
+	if is_running && !pvz.IsValid() {
+		pvz.Handle = FindWindow("MainWindow", pvz.title)
+		if pvz.Handle != 0 {
+			GetWindowThreadProcessId(pvz.Handle, &pvz.Pid)
+			pvz.ProcessHandle = OpenProcess(PROCESS_ALL_ACCESS, 0, pvz.Pid)
+		}
+	}
+	if is_running != game_running {
+		game_running = is_running
+		if is_running {
+			Notify(NotifyGame, "Game started", game_title)
+		} else {
+			Notify(NotifyGame, "Game exited", game_title)
+		}
+	}
+	return is_running
+}
+
+// @title: CanRestore
+// @description: 游戏未运行或不在选卡/关卡/失败界面时才能恢复存档
+// @return: bool
+func CanRestore() bool {
+	if !AttachGame() {
+		return true
+	}
+	return !pvz.GetGameUI().InLevel()
+}
+
+// fileSHA256 计算文件的SHA256
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
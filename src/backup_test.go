@@ -0,0 +1,72 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestListBackupsSkipsOtherDirs(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"2026.01.02 03-04-05", "2026.01.02 03-04-05 (2)", "renamed", "speedrun"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 带有备份信息的文件夹即使不是以时间命名也是备份
+	if err := os.WriteFile(filepath.Join(root, "renamed", backupMetaFile), []byte(`{"created":"2026-01-01T00:00:00Z","trigger":"manual"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// 没有备份信息时使用文件夹的修改时间
+	now := time.Now()
+	for _, dir := range []string{"2026.01.02 03-04-05", "2026.01.02 03-04-05 (2)"} {
+		if err := os.Chtimes(filepath.Join(root, dir), now, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	backups, err := listBackupsIn(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, b := range backups {
+		names = append(names, b.Name)
+	}
+	// 修改时间相同时按名称排序, 备份信息中的创建时间更早的排在最后
+	want := []string{"2026.01.02 03-04-05 (2)", "2026.01.02 03-04-05", "renamed"}
+	if len(names) != len(want) {
+		t.Fatalf("backups = %v, want %v", names, want)
+	}
+	for i := range want {
+		if names[i] != want[i] {
+			t.Fatalf("backups = %v, want %v", names, want)
+		}
+	}
+}
+
+func TestDefaultProfileBackupDir(t *testing.T) {
+	got := DefaultProfileBackupDir(filepath.Join("data", "backup"), "speedrun")
+	if want := filepath.Join("data", "backup-speedrun"); got != want {
+		t.Fatalf("DefaultProfileBackupDir = %s, want %s", got, want)
+	}
+}
+
+func TestValidBackupName(t *testing.T) {
+	for name, want := range map[string]bool{
+		"2026.01.02 03-04-05": true,
+		"renamed":             true,
+		"":                    false,
+		".":                   false,
+		"..":                  false,
+		"../data":             false,
+		"a/b":                 false,
+		"/tmp":                false,
+	} {
+		if got := validBackupName(name); got != want {
+			t.Errorf("validBackupName(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+)
+
+// LawnApp基址和字段偏移
+const (
+	lawnAppBase           = 0x6A9EC0
+	lawnAppBoardOffset    = 0x768 // 棋盘指针, 不在关卡中时为0
+	lawnAppGameModeOffset = 0x7F8 // 游戏模式
+	lawnAppGameUIOffset   = 0x7FC // 游戏界面
+	lawnAppMusicOffset    = 0x83C // 音乐指针
+	musicIDOffset         = 0x8   // 当前音乐
+	musicPausedOffset     = 0x40  // 音乐是否暂停
+)
+
+// 棋盘中对象数组的偏移, 依次为数组指针、最大使用数、当前数量
+const (
+	boardZombiesOffset     = 0x90
+	boardPlantsOffset      = 0xAC
+	boardProjectilesOffset = 0xC8
+	boardCoinsOffset       = 0xE4
+	dataArrayMaxUsedOffset = 0x4
+	dataArrayCountOffset   = 0x10
+)
+
+// @title: Memory
+// @description: 游戏内存, 测试时可以用内存镜像代替游戏进程
+type Memory interface {
+	// 读取一段内存, address为多级偏移
+	ReadBytes(size int, address ...int) ([]byte, error)
+}
+
+// @title: WritableMemory
+// @description: 可以写入的游戏内存
+type WritableMemory interface {
+	Memory
+	// 写入一段内存, address为多级偏移
+	WriteBytes(data []byte, address ...int) error
+}
+
+// @title: Board
+// @description: 从内存读取的棋盘状态
+type Board struct {
+	BoardState
+	// 游戏模式
+	GameMode int32 `json:"game_mode"`
+	// 关卡已进行的时间
+	Elapsed time.Duration `json:"elapsed"`
+	// 植物和僵尸数量
+	Plants  int32 `json:"plants"`
+	Zombies int32 `json:"zombies"`
+}
+
+// @title: ReadBoard
+// @description: 读取棋盘状态, 不在关卡中时返回错误
+// @param: m Memory 游戏内存
+// @return: *Board, error
+func ReadBoard(m Memory) (*Board, error) {
+	app, err := m.ReadBytes(lawnAppGameUIOffset+4, lawnAppBase, 0)
+	if err != nil {
+		return nil, err
+	}
+	if readInt32(app, lawnAppBoardOffset) == 0 {
+		return nil, fmt.Errorf("不在关卡中")
+	}
+	b, err := m.ReadBytes(boardSize, lawnAppBase, lawnAppBoardOffset, 0)
+	if err != nil {
+		return nil, err
+	}
+	board := &Board{
+		BoardState: decodeBoardState(b),
+		GameMode:   readInt32(app, lawnAppGameModeOffset),
+		Plants:     readInt32(b, boardPlantsOffset+dataArrayCountOffset),
+		Zombies:    readInt32(b, boardZombiesOffset+dataArrayCountOffset),
+	}
+	board.Elapsed = time.Duration(board.Clock) * 10 * time.Millisecond
+	return board, nil
+}
+
+// @title: Board::Summary
+// @description: 棋盘状态的简要描述
+// @return: string
+func (b *Board) Summary() string {
+	return fmt.Sprintf("level %d, mode %d, sun %d, wave %d/%d, %d plants, %d zombies, %s",
+		b.Level, b.GameMode, b.Sun, b.Wave, b.TotalWaves, b.Plants, b.Zombies, b.Elapsed.Truncate(time.Second))
+}
+
+// @title: NewDashboardTab
+// @description: 游戏状态页
+// @return: fyne.CanvasObject, func(*Board, *Entities, error) 每次读取棋盘后刷新, 对象可以为空
+func NewDashboardTab() (fyne.CanvasObject, func(*Board, *Entities, error)) {
+	labels := map[string]*widget.Label{}
+	names := []string{"level", "mode", "sun", "wave", "time", "plants", "zombies"}
+	form := widget.NewForm()
+	for _, name := range names {
+		labels[name] = widget.NewLabel("-")
+		form.Append(name, labels[name])
+	}
+	status_label := widget.NewLabel("")
+	entities_label := widget.NewLabel("")
+	entities_label.Wrapping = fyne.TextWrapWord
+
+	refresh := func(b *Board, e *Entities, err error) {
+		entities_label.SetText("")
+		if e != nil {
+			entities_label.SetText(e.Summary())
+		}
+		if err != nil {
+			status_label.SetText(err.Error())
+			for _, name := range names {
+				labels[name].SetText("-")
+			}
+			return
+		}
+		status_label.SetText("")
+		labels["level"].SetText(fmt.Sprint(b.Level))
+		labels["mode"].SetText(fmt.Sprint(b.GameMode))
+		labels["sun"].SetText(fmt.Sprint(b.Sun))
+		labels["wave"].SetText(fmt.Sprintf("%d / %d", b.Wave, b.TotalWaves))
+		labels["time"].SetText(b.Elapsed.Truncate(time.Second).String())
+		labels["plants"].SetText(fmt.Sprint(b.Plants))
+		labels["zombies"].SetText(fmt.Sprint(b.Zombies))
+	}
+	return container.NewVBox(form, entities_label, status_label), refresh
+}
+
+// @title: Entities
+// @description: 棋盘上存在的对象
+type Entities struct {
+	Plants      []Plant      `json:"plants"`
+	Zombies     []Zombie     `json:"zombies"`
+	Projectiles []Projectile `json:"projectiles"`
+	Coins       []Coin       `json:"coins"`
+}
+
+// @title: Entities::Summary
+// @description: 按类型统计植物和僵尸数量
+// @return: string
+func (e *Entities) Summary() string {
+	plants := []string{}
+	for _, p := range e.Plants {
+		plants = append(plants, p.Type.String())
+	}
+	zombies := []string{}
+	for _, z := range e.Zombies {
+		zombies = append(zombies, z.Type.String())
+	}
+	return fmt.Sprintf("plants: %s\nzombies: %s\nprojectiles: %d, coins: %d",
+		countNames(plants), countNames(zombies), len(e.Projectiles), len(e.Coins))
+}
+
+// countNames 统计每种名称的数量, 格式为 名称×数量
+func countNames(names []string) string {
+	counts := map[string]int{}
+	for _, name := range names {
+		counts[name]++
+	}
+	keys := []string{}
+	for name := range counts {
+		keys = append(keys, name)
+	}
+	sort.Strings(keys)
+	parts := []string{}
+	for _, name := range keys {
+		parts = append(parts, fmt.Sprintf("%s×%d", name, counts[name]))
+	}
+	if len(parts) == 0 {
+		return "-"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// @title: ReadEntities
+// @description: 读取棋盘上所有存在的对象
+// @param: m Memory 游戏内存
+// @return: *Entities, error
+func ReadEntities(m Memory) (*Entities, error) {
+	e := &Entities{}
+	var err error
+	if e.Plants, err = ReadPlants(m); err != nil {
+		return nil, err
+	}
+	if e.Zombies, err = ReadZombies(m); err != nil {
+		return nil, err
+	}
+	if e.Projectiles, err = ReadProjectiles(m); err != nil {
+		return nil, err
+	}
+	if e.Coins, err = ReadCoins(m); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// @title: ReadPlants
+// @description: 读取存在的植物
+// @param: m Memory 游戏内存
+// @return: []Plant, error
+func ReadPlants(m Memory) ([]Plant, error) {
+	items, err := readDataArray(m, boardPlantsOffset, plantSize)
+	plants := []Plant{}
+	for _, item := range items {
+		if p := decodePlant(item.Data); !p.Dead {
+			plants = append(plants, p)
+		}
+	}
+	return plants, err
+}
+
+// @title: ReadZombies
+// @description: 读取存在的僵尸
+// @param: m Memory 游戏内存
+// @return: []Zombie, error
+func ReadZombies(m Memory) ([]Zombie, error) {
+	items, err := readDataArray(m, boardZombiesOffset, zombieSize)
+	zombies := []Zombie{}
+	for _, item := range items {
+		if z := decodeZombie(item.Data); !z.Dead {
+			zombies = append(zombies, z)
+		}
+	}
+	return zombies, err
+}
+
+// @title: ReadProjectiles
+// @description: 读取存在的子弹
+// @param: m Memory 游戏内存
+// @return: []Projectile, error
+func ReadProjectiles(m Memory) ([]Projectile, error) {
+	items, err := readDataArray(m, boardProjectilesOffset, projectileSize)
+	projectiles := []Projectile{}
+	for _, item := range items {
+		if p := decodeProjectile(item.Data); !p.Dead {
+			projectiles = append(projectiles, p)
+		}
+	}
+	return projectiles, err
+}
+
+// @title: ReadCoins
+// @description: 读取存在且未被收集的掉落物
+// @param: m Memory 游戏内存
+// @return: []Coin, error
+func ReadCoins(m Memory) ([]Coin, error) {
+	items, err := readDataArray(m, boardCoinsOffset, coinSize)
+	coins := []Coin{}
+	for _, item := range items {
+		if c := decodeCoin(item.Data); !c.Dead && !c.Collected {
+			coins = append(coins, c)
+		}
+	}
+	return coins, err
+}
+
+// 对象数组最大使用数的上限, 防止读到错误的值时分配过多内存
+const maxDataArrayItems = 4096
+
+// dataArrayItem 对象数组中的一项
+type dataArrayItem struct {
+	// 在数组中的下标
+	Index int
+	Data  []byte
+}
+
+// readDataArray 读取棋盘中的对象数组, 只读取最大使用数以内且在使用中的项
+func readDataArray(m Memory, offset int, stride int) ([]dataArrayItem, error) {
+	header, err := m.ReadBytes(dataArrayCountOffset+4, lawnAppBase, lawnAppBoardOffset, offset)
+	if err != nil {
+		return nil, err
+	}
+	max_used := int(readInt32(header, dataArrayMaxUsedOffset))
+	if max_used <= 0 {
+		return nil, nil
+	}
+	if max_used > maxDataArrayItems {
+		return nil, fmt.Errorf("对象数组大小 %d 无效", max_used)
+	}
+	block, err := m.ReadBytes(max_used*stride, lawnAppBase, lawnAppBoardOffset, offset, 0)
+	if err != nil {
+		return nil, err
+	}
+	items := []dataArrayItem{}
+	for i := 0; i < max_used; i++ {
+		item := block[i*stride : (i+1)*stride]
+		if itemAlive(item) {
+			items = append(items, dataArrayItem{i, item})
+		}
+	}
+	return items, nil
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+	"time"
+)
+
+// 测试用内存镜像中的地址
+const (
+	testAppAddress       = 0x01000000
+	testBoardAddress     = 0x02000000
+	testZombiesArray     = 0x03000000
+	testPlantsArray      = 0x04000000
+	testProjectilesArray = 0x05000000
+	testCoinsArray       = 0x06000000
+)
+
+// testGame 在内存镜像中构造关卡, 对象数组中的项由测试填写
+type testGame struct {
+	*MemoryImage
+	app   []byte
+	board []byte
+	items map[int][]byte
+}
+
+func newTestGame() *testGame {
+	g := &testGame{MemoryImage: NewMemoryImage(), app: make([]byte, 0x900), board: make([]byte, boardSize), items: map[int][]byte{}}
+	g.WritePointer(lawnAppBase, testAppAddress)
+	g.Write(testAppAddress, g.app)
+	g.Write(testBoardAddress, g.board)
+	binary.LittleEndian.PutUint32(g.app[lawnAppBoardOffset:], testBoardAddress)
+	binary.LittleEndian.PutUint32(g.app[lawnAppGameUIOffset:], uint32(GameUIPlaying))
+	for offset, array := range map[int]uint32{
+		boardZombiesOffset:     testZombiesArray,
+		boardPlantsOffset:      testPlantsArray,
+		boardProjectilesOffset: testProjectilesArray,
+		boardCoinsOffset:       testCoinsArray,
+	} {
+		binary.LittleEndian.PutUint32(g.board[offset:], array)
+		g.items[offset] = []byte{}
+		g.Write(array, g.items[offset])
+	}
+	return g
+}
+
+// add 在对象数组末尾添加一项, fill填写对象内容, 返回该项
+func (g *testGame) add(offset, stride int, fill func(item []byte)) []byte {
+	index := len(g.items[offset]) / stride
+	data := append(g.items[offset], make([]byte, stride)...)
+	item := data[index*stride : (index+1)*stride]
+	fill(item)
+	binary.LittleEndian.PutUint32(item[stride-4:], uint32(index+1)<<16|uint32(index))
+	g.items[offset] = data
+	g.Write(binary.LittleEndian.Uint32(g.board[offset:]), data)
+	binary.LittleEndian.PutUint32(g.board[offset+dataArrayMaxUsedOffset:], uint32(index+1))
+	count := binary.LittleEndian.Uint32(g.board[offset+dataArrayCountOffset:])
+	binary.LittleEndian.PutUint32(g.board[offset+dataArrayCountOffset:], count+1)
+	return item
+}
+
+// addFree 在对象数组末尾添加一个空闲项, 空闲项的内容是已释放对象留下的数据
+func (g *testGame) addFree(offset, stride int) {
+	item := g.add(offset, stride, func(item []byte) {})
+	binary.LittleEndian.PutUint32(item[stride-4:], 0x1234)
+	count := binary.LittleEndian.Uint32(g.board[offset+dataArrayCountOffset:])
+	binary.LittleEndian.PutUint32(g.board[offset+dataArrayCountOffset:], count-1)
+}
+
+func (g *testGame) addPlant(t PlantType, row, col int32, dead bool) {
+	g.add(boardPlantsOffset, plantSize, func(item []byte) {
+		binary.LittleEndian.PutUint32(item[0x1C:], uint32(row))
+		binary.LittleEndian.PutUint32(item[0x24:], uint32(t))
+		binary.LittleEndian.PutUint32(item[0x28:], uint32(col))
+		if dead {
+			item[plantDeadOffset] = 1
+		}
+	})
+}
+
+func (g *testGame) addZombie(t ZombieType, row int32, dead bool) {
+	g.add(boardZombiesOffset, zombieSize, func(item []byte) {
+		binary.LittleEndian.PutUint32(item[0x1C:], uint32(row))
+		binary.LittleEndian.PutUint32(item[0x24:], uint32(t))
+		if dead {
+			item[zombieDeadOffset] = 1
+		}
+	})
+}
+
+func TestReadBoard(t *testing.T) {
+	g := newTestGame()
+	binary.LittleEndian.PutUint32(g.app[lawnAppGameModeOffset:], 13)
+	binary.LittleEndian.PutUint32(g.board[boardSceneOffset:], 2)
+	binary.LittleEndian.PutUint32(g.board[boardLevelOffset:], 21)
+	binary.LittleEndian.PutUint32(g.board[boardSunOffset:], 425)
+	binary.LittleEndian.PutUint32(g.board[boardWaveOffset:], 7)
+	binary.LittleEndian.PutUint32(g.board[boardTotalWavesOffset:], 20)
+	binary.LittleEndian.PutUint32(g.board[boardClockOffset:], 12345)
+	g.addPlant(0, 0, 0, false)
+	g.addPlant(1, 1, 0, false)
+	g.addZombie(0, 2, false)
+
+	b, err := ReadBoard(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Board{
+		BoardState: BoardState{Scene: 2, Level: 21, Sun: 425, Wave: 7, TotalWaves: 20, Clock: 12345},
+		GameMode:   13,
+		Elapsed:    123450 * time.Millisecond,
+		Plants:     2,
+		Zombies:    1,
+	}
+	if *b != want {
+		t.Fatalf("board = %+v\nwant %+v", *b, want)
+	}
+
+	// 不在关卡中
+	binary.LittleEndian.PutUint32(g.app[lawnAppBoardOffset:], 0)
+	if _, err := ReadBoard(g); err == nil {
+		t.Fatal("expected error without a board")
+	}
+}
+
+func TestReadEntities(t *testing.T) {
+	g := newTestGame()
+	g.add(boardPlantsOffset, plantSize, func(item []byte) {
+		binary.LittleEndian.PutUint32(item[0x08:], 120)
+		binary.LittleEndian.PutUint32(item[0x0C:], 180)
+		binary.LittleEndian.PutUint32(item[0x1C:], 1)
+		binary.LittleEndian.PutUint32(item[0x24:], 8)
+		binary.LittleEndian.PutUint32(item[0x28:], 1)
+		binary.LittleEndian.PutUint32(item[0x40:], 200)
+		binary.LittleEndian.PutUint32(item[0x44:], 300)
+		item[0x143] = 1
+	})
+	g.addFree(boardPlantsOffset, plantSize)
+	g.addPlant(3, 2, 2, true)
+	g.add(boardZombiesOffset, zombieSize, func(item []byte) {
+		binary.LittleEndian.PutUint32(item[0x1C:], 4)
+		binary.LittleEndian.PutUint32(item[0x24:], 4)
+		binary.LittleEndian.PutUint32(item[0x28:], 0)
+		binary.LittleEndian.PutUint32(item[0x2C:], math.Float32bits(700.5))
+		binary.LittleEndian.PutUint32(item[0x30:], math.Float32bits(400))
+		binary.LittleEndian.PutUint32(item[0xC8:], 270)
+		binary.LittleEndian.PutUint32(item[0xCC:], 270)
+		binary.LittleEndian.PutUint32(item[0xD0:], 1100)
+	})
+	g.add(boardProjectilesOffset, projectileSize, func(item []byte) {
+		binary.LittleEndian.PutUint32(item[0x1C:], 4)
+		binary.LittleEndian.PutUint32(item[0x30:], math.Float32bits(300))
+		binary.LittleEndian.PutUint32(item[0x5C:], 1)
+	})
+	g.add(boardProjectilesOffset, projectileSize, func(item []byte) { item[0x50] = 1 })
+	g.add(boardCoinsOffset, coinSize, func(item []byte) {
+		binary.LittleEndian.PutUint32(item[0x24:], math.Float32bits(50))
+		binary.LittleEndian.PutUint32(item[0x58:], 4)
+	})
+	g.add(boardCoinsOffset, coinSize, func(item []byte) { item[0x50] = 1 })
+
+	e, err := ReadEntities(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantPlant := Plant{Type: 8, Row: 1, Col: 1, X: 120, Y: 180, HP: 200, MaxHP: 300, Asleep: true}
+	if len(e.Plants) != 1 || e.Plants[0] != wantPlant {
+		t.Fatalf("plants = %+v", e.Plants)
+	}
+	wantZombie := Zombie{Type: 4, Row: 4, X: 700.5, Y: 400, HP: 270, MaxHP: 270, HelmHP: 1100}
+	if len(e.Zombies) != 1 || e.Zombies[0] != wantZombie {
+		t.Fatalf("zombies = %+v", e.Zombies)
+	}
+	if len(e.Projectiles) != 1 || e.Projectiles[0] != (Projectile{Type: 1, Row: 4, X: 300}) {
+		t.Fatalf("projectiles = %+v", e.Projectiles)
+	}
+	if len(e.Coins) != 1 || e.Coins[0] != (Coin{Type: 4, X: 50}) {
+		t.Fatalf("coins = %+v", e.Coins)
+	}
+}
+
+func TestReadEntitiesInvalidArray(t *testing.T) {
+	g := newTestGame()
+	binary.LittleEndian.PutUint32(g.board[boardZombiesOffset+dataArrayMaxUsedOffset:], maxDataArrayItems+1)
+	if _, err := ReadEntities(g); err == nil {
+		t.Fatal("expected error for an invalid array size")
+	}
+	// 数组指针指向无法读取的地址
+	g = newTestGame()
+	g.addPlant(0, 0, 0, false)
+	binary.LittleEndian.PutUint32(g.board[boardPlantsOffset:], 0x7F000000)
+	if _, err := ReadEntities(g); err == nil {
+		t.Fatal("expected error for an unreadable array")
+	}
+}
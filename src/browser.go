@@ -0,0 +1,373 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// 备份列表的列
+const (
+	columnCheck = iota
+	columnPinned
+	columnCreated
+	columnName
+	columnTrigger
+	columnSize
+	columnLevel
+	columnVerified
+	columnCount
+)
+
+var browserColumnWidths = [columnCount]float32{30, 30, 150, 160, 60, 70, 50, 70}
+
+// 备份列表的排序方式
+var browserSorts = map[string]func(a, b BackupInfo) bool{
+	"newest": func(a, b BackupInfo) bool { return a.Created.After(b.Created) },
+	"oldest": func(a, b BackupInfo) bool { return a.Created.Before(b.Created) },
+	"name":   func(a, b BackupInfo) bool { return strings.ToLower(backupTitle(a)) < strings.ToLower(backupTitle(b)) },
+	"size":   func(a, b BackupInfo) bool { return a.Size > b.Size },
+	"level":  func(a, b BackupInfo) bool { return a.Level > b.Level },
+}
+
+// 校验状态
+const (
+	verifyPending = "..."
+	verifyOK      = "ok"
+	verifyFailed  = "failed"
+	verifyNoMeta  = "n/a"
+)
+
+// @title: BackupBrowser
+// @description: 备份列表, 可以搜索、排序、多选删除、固定、重命名和打开文件夹
+type BackupBrowser struct {
+	// 选中的备份变化时的回调, 没有选中时为空
+	OnSelected func(name string)
+
+	w        fyne.Window
+	table    *widget.Table
+	search   *widget.Entry
+	sort_by  *widget.Select
+	selected string
+
+	lock     sync.Mutex
+	backups  []BackupInfo
+	rows     []BackupInfo
+	checked  map[string]bool
+	verified map[string]string
+	verifier chan string
+}
+
+// @title: NewBackupBrowser
+// @description: 创建备份列表
+// @param: w fyne.Window 父窗口
+// @param: onSelected func(string) 选中的备份变化时的回调
+// @return: *BackupBrowser
+func NewBackupBrowser(w fyne.Window, onSelected func(name string)) *BackupBrowser {
+	b := &BackupBrowser{
+		OnSelected: onSelected,
+		w:          w,
+		checked:    map[string]bool{},
+		verified:   map[string]string{},
+		verifier:   make(chan string),
+	}
+	b.table = widget.NewTable(b.size, func() fyne.CanvasObject {
+		return widget.NewLabel("")
+	}, b.updateCell)
+	for i, width := range browserColumnWidths {
+		b.table.SetColumnWidth(i, width)
+	}
+	b.table.OnSelected = b.onCellSelected
+
+	b.search = widget.NewEntry()
+	b.search.SetPlaceHolder("search, #tag")
+	b.search.OnChanged = func(string) { b.update() }
+	names := []string{}
+	for name := range browserSorts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	b.sort_by = widget.NewSelect(names, func(string) { b.update() })
+	b.sort_by.SetSelected("newest")
+
+	go b.verify()
+	return b
+}
+
+// @title: BackupBrowser::Widget
+// @description: 备份列表的界面
+// @return: fyne.CanvasObject
+func (b *BackupBrowser) Widget() fyne.CanvasObject {
+	actions := container.NewGridWithColumns(4,
+		widget.NewButton("delete", b.deleteChecked),
+		widget.NewButton("pin", b.togglePinned),
+		widget.NewButton("rename", b.rename),
+		widget.NewButton("open folder", func() {
+			if b.selected != "" {
+				OpenFolder(BackupDir(b.selected))
+			}
+		}),
+	)
+	top := container.NewBorder(nil, nil, nil, b.sort_by, b.search)
+	return container.NewBorder(top, actions, nil, nil, b.table)
+}
+
+// @title: BackupBrowser::SetBackups
+// @description: 更新备份列表, 列表没有变化时不刷新, 以免重置滚动位置
+// @param: backups []BackupInfo
+func (b *BackupBrowser) SetBackups(backups []BackupInfo) {
+	b.lock.Lock()
+	if reflect.DeepEqual(backups, b.backups) {
+		b.lock.Unlock()
+		return
+	}
+	b.backups = backups
+	b.lock.Unlock()
+	b.update()
+}
+
+// @title: BackupBrowser::Selected
+// @description: 当前选中的备份
+// @return: string
+func (b *BackupBrowser) Selected() string {
+	return b.selected
+}
+
+// update 重新筛选和排序并刷新列表
+func (b *BackupBrowser) update() {
+	b.lock.Lock()
+	rows := FilterBackups(b.backups, b.search.Text)
+	if less, ok := browserSorts[b.sort_by.Selected]; ok {
+		sort.SliceStable(rows, func(i, j int) bool { return less(rows[i], rows[j]) })
+	}
+	b.rows = rows
+	exists := map[string]bool{}
+	pending := []string{}
+	for _, row := range b.backups {
+		exists[row.Name] = true
+		if _, ok := b.verified[row.Name]; !ok {
+			b.verified[row.Name] = verifyPending
+			pending = append(pending, row.Name)
+		}
+	}
+	for name := range b.checked {
+		if !exists[name] {
+			delete(b.checked, name)
+		}
+	}
+	selected_gone := b.selected != "" && !exists[b.selected]
+	b.lock.Unlock()
+
+	// 校验较慢, 不在持有锁时排队
+	go func() {
+		for _, name := range pending {
+			b.verifier <- name
+		}
+	}()
+
+	if selected_gone {
+		b.selected = ""
+		b.table.UnselectAll()
+		b.OnSelected("")
+	}
+	b.table.Refresh()
+}
+
+// verify 在后台依次校验备份
+func (b *BackupBrowser) verify() {
+	for name := range b.verifier {
+		status := verifyOK
+		problems, err := VerifyBackup(name)
+		switch {
+		case err != nil && !IsDir(BackupDir(name)):
+			continue
+		case err != nil:
+			status = verifyNoMeta
+		case len(problems) > 0:
+			status = verifyFailed
+		}
+		b.lock.Lock()
+		b.verified[name] = status
+		b.lock.Unlock()
+		b.table.Refresh()
+	}
+}
+
+// size 表格的行数和列数
+func (b *BackupBrowser) size() (int, int) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return len(b.rows), columnCount
+}
+
+// updateCell 填充单元格
+func (b *BackupBrowser) updateCell(id widget.TableCellID, cell fyne.CanvasObject) {
+	label := cell.(*widget.Label)
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if id.Row >= len(b.rows) {
+		label.SetText("")
+		return
+	}
+	row := b.rows[id.Row]
+	text := ""
+	switch id.Col {
+	case columnCheck:
+		text = "☐"
+		if b.checked[row.Name] {
+			text = "☑"
+		}
+	case columnPinned:
+		if row.Pinned {
+			text = "📌"
+		}
+	case columnCreated:
+		text = row.Created.Format("2006-01-02 15:04:05")
+	case columnName:
+		text = backupTitle(row)
+	case columnTrigger:
+		text = row.Trigger
+	case columnSize:
+		text = FormatSize(row.Size)
+	case columnLevel:
+		if row.Level > 0 {
+			text = fmt.Sprint(row.Level)
+		}
+	case columnVerified:
+		text = b.verified[row.Name]
+	}
+	label.SetText(text)
+}
+
+// onCellSelected 点击勾选列时切换勾选, 点击其他列时选中备份
+func (b *BackupBrowser) onCellSelected(id widget.TableCellID) {
+	b.lock.Lock()
+	if id.Row >= len(b.rows) {
+		b.lock.Unlock()
+		return
+	}
+	name := b.rows[id.Row].Name
+	if id.Col == columnCheck {
+		b.checked[name] = !b.checked[name]
+	}
+	b.lock.Unlock()
+
+	if id.Col == columnCheck {
+		b.table.Refresh()
+	}
+	if name != b.selected {
+		b.selected = name
+		b.OnSelected(name)
+	}
+}
+
+// checkedNames 勾选的备份, 没有勾选时为选中的备份
+func (b *BackupBrowser) checkedNames() []string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	names := []string{}
+	for _, row := range b.rows {
+		if b.checked[row.Name] {
+			names = append(names, row.Name)
+		}
+	}
+	if len(names) == 0 && b.selected != "" {
+		names = append(names, b.selected)
+	}
+	return names
+}
+
+// deleteChecked 删除勾选的备份
+func (b *BackupBrowser) deleteChecked() {
+	names := b.checkedNames()
+	if len(names) == 0 {
+		return
+	}
+	message := fmt.Sprintf("Delete %d backups?", len(names))
+	if len(names) == 1 {
+		message = "Delete " + names[0] + "?"
+	}
+	dialog.NewConfirm("Delete", message, func(ok bool) {
+		if !ok {
+			return
+		}
+		if err := DeleteBackups(names); err != nil {
+			dialog.NewInformation("Error", err.Error(), b.w).Show()
+		}
+		b.reload()
+	}, b.w).Show()
+}
+
+// togglePinned 固定或取消固定选中的备份
+func (b *BackupBrowser) togglePinned() {
+	row, ok := b.selectedRow()
+	if !ok {
+		return
+	}
+	if err := SetBackupPinned(row.Name, !row.Pinned); err != nil {
+		dialog.NewInformation("Error", err.Error(), b.w).Show()
+	}
+	b.reload()
+}
+
+// rename 修改选中备份的显示名称
+func (b *BackupBrowser) rename() {
+	row, ok := b.selectedRow()
+	if !ok {
+		return
+	}
+	entry := widget.NewEntry()
+	entry.SetText(row.Label)
+	dialog.NewForm("Rename", "Save", "Cancel", []*widget.FormItem{widget.NewFormItem("name", entry)}, func(ok bool) {
+		if !ok {
+			return
+		}
+		if err := RenameBackup(row.Name, entry.Text); err != nil {
+			dialog.NewInformation("Error", err.Error(), b.w).Show()
+		}
+		b.reload()
+	}, b.w).Show()
+}
+
+// selectedRow 选中的备份
+func (b *BackupBrowser) selectedRow() (BackupInfo, bool) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	for _, row := range b.backups {
+		if row.Name == b.selected {
+			return row, true
+		}
+	}
+	return BackupInfo{}, false
+}
+
+// reload 修改备份后立即重新读取列表
+func (b *BackupBrowser) reload() {
+	if backups, err := ListBackups(); err == nil {
+		b.SetBackups(backups)
+	}
+}
+
+// backupTitle 备份显示的名称, 没有填写名称时使用文件夹名
+func backupTitle(b BackupInfo) string {
+	if b.Label != "" {
+		return b.Label
+	}
+	return b.Name
+}
+
+// @title: OpenFolder
+// @description: 在资源管理器中打开文件夹
+// @param: path string 文件夹路径
+// @return: error
+func OpenFolder(path string) error {
+	return exec.Command("explorer", path).Start()
+}
@@ -0,0 +1,847 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// cliCommand 命令行子命令
+type cliCommand struct {
+	usage string
+	run   func(args []string) int
+}
+
+var cliCommands map[string]cliCommand
+
+func init() {
+	cliCommands = map[string]cliCommand{
+		"backup":   {"backup [-json] [-name s] [-note s] [-tags a,b]", cliBackup},
+		"list":     {"list [-json] [-search query]", cliList},
+		"restore":  {"restore [-json] <name>", cliRestore},
+		"verify":   {"verify [-json] [name...]", cliVerify},
+		"prune":    {"prune [-json] [-keep n]", cliPrune},
+		"watch":    {"watch [-json] [-interval 30s] [-keep n] [-on-save]", cliWatch},
+		"status":   {"status [-json]", cliStatus},
+		"diff":     {"diff [-json] <old> [new]", cliDiff},
+		"edit":     {"edit -user <id> [options]", cliEdit},
+		"profile":  {"profile [-json] [switch <name>]", cliProfile},
+		"board":    {"board [-json]", cliBoard},
+		"trainer":  {"trainer [-json] [sun <n> | on <toggle> | off <toggle>]", cliTrainer},
+		"action":   {"action [-json] plant <row> <col> <plant> | shovel <row> <col> | zombie <row> <zombie> [col] | clear-zombies", cliAction},
+		"scenario": {"scenario [-json] [-force] apply <file> | export [file]", cliScenario},
+		"history":  {"history [-json] | export [-levels] [file.csv]", cliHistory},
+		"script":   {"script check <file> | run [-dry] <file>", cliScript},
+		"serve":    {"serve [-addr host:port] [-token s]", cliServe},
+		"music":    {"music [-json] [play <id|name> | stop | next | lock <id|name> | unlock]", cliMusic},
+	}
+}
+
+// @title: RunCLI
+// @description: 命令行入口
+// @param: args []string 命令行参数(不含程序名)
+// @return: int 退出码
+func RunCLI(args []string) int {
+	cmd, ok := cliCommands[args[0]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command: %s\n", args[0])
+		cliUsage()
+		return 2
+	}
+	MakeDir(backup_path)
+	return cmd.run(args[1:])
+}
+
+// cliUsage 输出所有子命令的用法
+func cliUsage() {
+	names := []string{}
+	for name := range cliCommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintln(os.Stderr, "usage:")
+	for _, name := range names {
+		fmt.Fprintln(os.Stderr, "  pvzhe_utils "+cliCommands[name].usage)
+	}
+}
+
+// newFlagSet 创建子命令的参数解析, 所有子命令都支持-json
+func newFlagSet(name string) (*flag.FlagSet, *bool) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	as_json := fs.Bool("json", false, "machine-readable JSON output")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: pvzhe_utils "+cliCommands[name].usage)
+		fs.PrintDefaults()
+	}
+	return fs, as_json
+}
+
+// parseFlags 解析参数, 子命令后面的参数也会被解析, 例如 script run -dry <file>
+// 返回除参数外的部分
+func parseFlags(fs *flag.FlagSet, args []string) ([]string, error) {
+	rest := []string{}
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return rest, nil
+		}
+		rest = append(rest, args[0])
+		args = args[1:]
+	}
+}
+
+// printResult 输出结果, as_json为true时输出JSON, 否则输出文本
+func printResult(as_json bool, v interface{}, text func()) {
+	if as_json {
+		data, _ := json.Marshal(v)
+		fmt.Println(string(data))
+		return
+	}
+	text()
+}
+
+// printError 输出错误, 返回退出码1
+func printError(as_json bool, err error) int {
+	if as_json {
+		data, _ := json.Marshal(map[string]string{"error": err.Error()})
+		fmt.Println(string(data))
+	} else {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	return 1
+}
+
+// cliBackup 立即备份, 游戏在关卡中时先调用游戏保存
+func cliBackup(args []string) int {
+	fs, as_json := newFlagSet("backup")
+	label := fs.String("name", "", "display name stored in the backup metadata")
+	note := fs.String("note", "", "note stored in the backup metadata")
+	tags := fs.String("tags", "", "comma separated tags")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	backup_name, err := ManualBackup(*label, *note, ParseTags(*tags))
+	if err != nil {
+		return printError(*as_json, err)
+	}
+	printResult(*as_json, map[string]string{"name": backup_name}, func() {
+		fmt.Println(backup_name)
+	})
+	return 0
+}
+
+// cliList 列出所有备份
+func cliList(args []string) int {
+	fs, as_json := newFlagSet("list")
+	search := fs.String("search", "", "only list backups matching the words, #tag matches a tag")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	backups, err := ListBackups()
+	if err != nil {
+		return printError(*as_json, err)
+	}
+	backups = FilterBackups(backups, *search)
+	printResult(*as_json, backups, func() {
+		for _, b := range backups {
+			fmt.Printf("%s\t%s\t%d files\t%s\t%s\n", b.Name, FormatSize(b.Size), b.Files, b.Trigger, b.Label)
+		}
+	})
+	return 0
+}
+
+// cliRestore 恢复备份
+func cliRestore(args []string) int {
+	fs, as_json := newFlagSet("restore")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+	name := fs.Arg(0)
+	if !CanRestore() {
+		return printError(*as_json, errors.New("请先退出关卡再恢复存档！"))
+	}
+	if err := RestoreBackup(name); err != nil {
+		return printError(*as_json, err)
+	}
+	printResult(*as_json, map[string]string{"restored": name}, func() {
+		fmt.Println("restored", name)
+	})
+	return 0
+}
+
+// cliVerify 校验备份, 不指定备份名时校验所有备份
+func cliVerify(args []string) int {
+	fs, as_json := newFlagSet("verify")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	names := fs.Args()
+	if len(names) == 0 {
+		backups, err := ListBackups()
+		if err != nil {
+			return printError(*as_json, err)
+		}
+		for _, b := range backups {
+			names = append(names, b.Name)
+		}
+	}
+
+	type result struct {
+		Name     string   `json:"name"`
+		OK       bool     `json:"ok"`
+		Problems []string `json:"problems,omitempty"`
+		Error    string   `json:"error,omitempty"`
+	}
+	results := []result{}
+	code := 0
+	for _, name := range names {
+		problems, err := VerifyBackup(name)
+		r := result{Name: name, OK: err == nil && len(problems) == 0, Problems: problems}
+		if err != nil {
+			r.Error = err.Error()
+		}
+		if !r.OK {
+			code = 1
+		}
+		results = append(results, r)
+	}
+	printResult(*as_json, results, func() {
+		for _, r := range results {
+			switch {
+			case r.Error != "":
+				fmt.Printf("%s: %s\n", r.Name, r.Error)
+			case r.OK:
+				fmt.Printf("%s: ok\n", r.Name)
+			default:
+				fmt.Printf("%s:\n", r.Name)
+				for _, p := range r.Problems {
+					fmt.Println("    " + p)
+				}
+			}
+		}
+	})
+	return code
+}
+
+// cliPrune 删除多余的备份
+func cliPrune(args []string) int {
+	fs, as_json := newFlagSet("prune")
+	keep := fs.Int("keep", max_backups, "number of backups to keep")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	removed, err := PruneBackups(*keep)
+	if err != nil {
+		return printError(*as_json, err)
+	}
+	printResult(*as_json, map[string][]string{"removed": removed}, func() {
+		for _, name := range removed {
+			fmt.Println("removed", name)
+		}
+	})
+	return 0
+}
+
+// cliWatch 不打开窗口运行自动保存, 按Ctrl+C退出
+func cliWatch(args []string) int {
+	fs, as_json := newFlagSet("watch")
+	interval := fs.Duration("interval", auto_save_interval, "auto save interval")
+	keep := fs.Int("keep", max_backups, "number of backups to keep")
+	on_save := fs.Bool("on-save", backup_on_save, "also back up whenever the game writes its save data")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *interval <= 0 {
+		fmt.Fprintln(fs.Output(), "interval must be greater than 0")
+		fs.Usage()
+		return 2
+	}
+	if *on_save {
+		backup_on_save = true
+		if err := backup_index.Watch(backup_path, data_path); err != nil {
+			return printError(*as_json, err)
+		}
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt)
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+	for {
+		if AttachGame() && pvz.GetGameUI() == GameUIPlaying {
+			backup_name, err := SaveAndBackup(TriggerAuto)
+			if err != nil {
+				log.Println(err)
+			} else {
+				printResult(*as_json, map[string]string{"event": "backup", "name": backup_name}, func() {
+					fmt.Println("backup", backup_name)
+				})
+			}
+		}
+		removed, err := PruneBackups(*keep)
+		if err != nil {
+			log.Println(err)
+		}
+		for _, name := range removed {
+			printResult(*as_json, map[string]string{"event": "prune", "name": name}, func() {
+				fmt.Println("removed", name)
+			})
+		}
+
+		select {
+		case <-stop:
+			return 0
+		case <-ticker.C:
+		}
+	}
+}
+
+// cliStatus 输出游戏和备份状态
+func cliStatus(args []string) int {
+	fs, as_json := newFlagSet("status")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	status := CurrentStatus()
+	printResult(*as_json, status, func() {
+		fmt.Printf("running: %v\ngame ui: %s\nmusic: %s\ndata dir: %s\nbackups: %d\nlatest: %s\n",
+			status.Running, status.GameUIName, status.MusicName, status.DataDir, status.Backups, status.Latest)
+		if status.Board != nil {
+			fmt.Println("board:", status.Board.Summary())
+		}
+	})
+	return 0
+}
+
+// cliDiff 比较两个快照, 快照名为备份名或live
+func cliDiff(args []string) int {
+	fs, as_json := newFlagSet("diff")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() < 1 || fs.NArg() > 2 {
+		fs.Usage()
+		fmt.Fprintln(fs.Output(), "snapshot names are backup folder names, or \"live\" for the current save data (default for new)")
+		return 2
+	}
+	old_name := fs.Arg(0)
+	new_name := LiveSnapshot
+	if fs.NArg() == 2 {
+		new_name = fs.Arg(1)
+	}
+
+	diffs, err := DiffDirs(SnapshotPath(old_name), SnapshotPath(new_name))
+	if err != nil {
+		return printError(*as_json, err)
+	}
+	printResult(*as_json, diffs, func() {
+		fmt.Print(FormatDiff(diffs))
+	})
+	return 0
+}
+
+// cliEdit 离线修改用户存档, 每次修改前都会备份
+func cliEdit(args []string) int {
+	fs, as_json := newFlagSet("edit")
+	user := fs.Int("user", 1, "user id, the file edited is user<id>.dat")
+	coins := fs.Int("coins", -1, "set coins (multiple of 10)")
+	level := fs.Int("level", 0, "set adventure level (1-50)")
+	reset_mode := fs.Int("reset-mode", 0, "clear the completion record of a game mode")
+	unlock_plants := fs.Bool("unlock-plants", false, "unlock all shop plants")
+	unlock_minigames := fs.Bool("unlock-minigames", false, "unlock mini-games, puzzle and survival")
+	repair := fs.Bool("repair", false, "repair a corrupted profile")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	edits := []func(*UserData) error{}
+	if *coins >= 0 {
+		edits = append(edits, SetCoins(*coins))
+	}
+	if *level != 0 {
+		edits = append(edits, SetAdventureLevel(*level))
+	}
+	if *reset_mode != 0 {
+		edits = append(edits, ResetMode(*reset_mode))
+	}
+	if *unlock_plants {
+		edits = append(edits, UnlockPlants)
+	}
+	if *unlock_minigames {
+		edits = append(edits, UnlockMinigames)
+	}
+	if len(edits) == 0 && !*repair {
+		fs.Usage()
+		return 2
+	}
+
+	result := map[string]string{"user": fmt.Sprintf("user%d.dat", *user)}
+	if *repair {
+		backup_name, err := RepairUserData(*user)
+		if err != nil {
+			return printError(*as_json, err)
+		}
+		result["repair_backup"] = backup_name
+	}
+	if len(edits) > 0 {
+		backup_name, err := EditUserData(*user, func(u *UserData) error {
+			for _, edit := range edits {
+				if err := edit(u); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return printError(*as_json, err)
+		}
+		result["backup"] = backup_name
+	}
+	printResult(*as_json, result, func() {
+		if result["repair_backup"] != "" {
+			fmt.Printf("repaired %s, backup: %s\n", result["user"], result["repair_backup"])
+		}
+		if result["backup"] != "" {
+			fmt.Printf("edited %s, backup: %s\n", result["user"], result["backup"])
+		}
+	})
+	return 0
+}
+
+// cliProfile 列出存档配置, 或切换到指定的存档配置
+func cliProfile(args []string) int {
+	fs, as_json := newFlagSet("profile")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	switch {
+	case fs.NArg() == 0:
+		c := CurrentConfig()
+		active := c.Profile().Name
+		type result struct {
+			SaveProfile
+			Active bool `json:"active"`
+		}
+		results := []result{}
+		for _, name := range c.ProfileNames() {
+			// 输出补全后的实际目录
+			effective := c
+			effective.ActiveProfile = name
+			results = append(results, result{effective.Profile(), name == active})
+		}
+		printResult(*as_json, results, func() {
+			for _, r := range results {
+				mark := " "
+				if r.Active {
+					mark = "*"
+				}
+				fmt.Printf("%s %s\t%s\t%s\n", mark, r.Name, r.DataDir, r.BackupDir)
+			}
+		})
+	case fs.NArg() == 2 && fs.Arg(0) == "switch":
+		name := fs.Arg(1)
+		backup_name, err := SwitchProfile(name)
+		if err != nil {
+			return printError(*as_json, err)
+		}
+		printResult(*as_json, map[string]string{"profile": name, "backup": backup_name}, func() {
+			fmt.Printf("switched to %s, backup: %s\n", name, backup_name)
+		})
+	default:
+		fs.Usage()
+		return 2
+	}
+	return 0
+}
+
+// cliBoard 输出棋盘上的植物、僵尸、子弹和掉落物
+func cliBoard(args []string) int {
+	fs, as_json := newFlagSet("board")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if !AttachGame() {
+		return printError(*as_json, errors.New("游戏未运行"))
+	}
+	board, err := ReadBoard(pvz)
+	if err != nil {
+		return printError(*as_json, err)
+	}
+	entities, err := ReadEntities(pvz)
+	if err != nil {
+		return printError(*as_json, err)
+	}
+	result := struct {
+		Board    *Board    `json:"board"`
+		Entities *Entities `json:"entities"`
+	}{board, entities}
+	printResult(*as_json, result, func() {
+		fmt.Println(board.Summary())
+		for _, p := range entities.Plants {
+			fmt.Printf("plant   %-16s  row %d col %d  hp %d/%d\n", p.Type, p.Row, p.Col, p.HP, p.MaxHP)
+		}
+		for _, z := range entities.Zombies {
+			fmt.Printf("zombie  %-16s  row %d x %.0f  hp %d/%d\n", z.Type, z.Row, z.X, z.HP, z.MaxHP)
+		}
+		fmt.Printf("projectiles: %d, coins: %d\n", len(entities.Projectiles), len(entities.Coins))
+	})
+	return 0
+}
+
+// cliMusic 查看或控制游戏音乐
+func cliMusic(args []string) int {
+	fs, as_json := newFlagSet("music")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	AttachGame()
+	var err error
+	switch {
+	case fs.NArg() == 0:
+	case fs.NArg() == 2 && fs.Arg(0) == "play":
+		var id MusicID
+		if id, err = ParseMusic(fs.Arg(1)); err == nil {
+			err = music.Play(id)
+		}
+	case fs.NArg() == 1 && fs.Arg(0) == "stop":
+		err = music.Stop()
+	case fs.NArg() == 1 && fs.Arg(0) == "next":
+		_, err = music.Next()
+	case fs.NArg() == 2 && fs.Arg(0) == "lock":
+		var id MusicID
+		if id, err = ParseMusic(fs.Arg(1)); err == nil {
+			err = UpdateConfig(func(c *Config) { c.LockedMusic = id })
+		}
+	case fs.NArg() == 1 && fs.Arg(0) == "unlock":
+		err = UpdateConfig(func(c *Config) { c.LockedMusic = MusicNone })
+	default:
+		fs.Usage()
+		return 2
+	}
+	if err != nil {
+		return printError(*as_json, err)
+	}
+
+	current, _ := music.Current()
+	result := map[string]interface{}{"music": current, "name": current.String(), "locked": music.Locked()}
+	printResult(*as_json, result, func() {
+		fmt.Printf("music: %s\nlocked: %s\n", current, music.Locked())
+	})
+	return 0
+}
+
+// cliTrainer 查看或修改修改器开关, 命令行退出后修改仍然有效, 直到游戏重启或用off关闭
+func cliTrainer(args []string) int {
+	fs, as_json := newFlagSet("trainer")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if !AttachGame() {
+		return printError(*as_json, errors.New("游戏未运行"))
+	}
+	var err error
+	switch {
+	case fs.NArg() == 0:
+	case fs.NArg() == 2 && fs.Arg(0) == "sun":
+		var sun int
+		if sun, err = strconv.Atoi(fs.Arg(1)); err == nil {
+			err = SetSun(pvz, sun)
+		}
+	case fs.NArg() == 2 && (fs.Arg(0) == "on" || fs.Arg(0) == "off"):
+		err = SetTrainerToggle(fs.Arg(1), fs.Arg(0) == "on")
+	default:
+		fs.Usage()
+		return 2
+	}
+	if err != nil {
+		return printError(*as_json, err)
+	}
+
+	states := map[string]string{}
+	for _, toggle := range trainerToggles {
+		state, err := patches.State(toggle.Name)
+		if err != nil {
+			state = err.Error()
+		}
+		states[toggle.Name] = state
+	}
+	printResult(*as_json, states, func() {
+		for _, toggle := range trainerToggles {
+			fmt.Printf("%-14s %s\n", toggle.Name, states[toggle.Name])
+		}
+	})
+	return 0
+}
+
+// cliAction 在当前关卡中种植、铲除植物或生成、清除僵尸, 行列从0开始
+func cliAction(args []string) int {
+	fs, as_json := newFlagSet("action")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if !AttachGame() {
+		return printError(*as_json, errors.New("游戏未运行"))
+	}
+	ints := func(args ...string) ([]int, error) {
+		values := []int{}
+		for _, arg := range args {
+			v, err := strconv.Atoi(arg)
+			if err != nil {
+				return nil, fmt.Errorf("%s 不是数字", arg)
+			}
+			values = append(values, v)
+		}
+		return values, nil
+	}
+
+	actions := NewActions()
+	result := map[string]interface{}{"action": fs.Arg(0)}
+	var err error
+	switch {
+	case fs.NArg() == 4 && fs.Arg(0) == "plant":
+		var cell []int
+		var t PlantType
+		if cell, err = ints(fs.Arg(1), fs.Arg(2)); err == nil {
+			if t, err = ParsePlantType(fs.Arg(3)); err == nil {
+				err = actions.PlacePlant(cell[0], cell[1], t)
+			}
+		}
+	case fs.NArg() == 3 && fs.Arg(0) == "shovel":
+		var cell []int
+		if cell, err = ints(fs.Arg(1), fs.Arg(2)); err == nil {
+			result["removed"], err = actions.ShovelPlant(cell[0], cell[1])
+		}
+	case (fs.NArg() == 3 || fs.NArg() == 4) && fs.Arg(0) == "zombie":
+		var cell []int
+		var t ZombieType
+		col := "9"
+		if fs.NArg() == 4 {
+			col = fs.Arg(3)
+		}
+		if cell, err = ints(fs.Arg(1), col); err == nil {
+			if t, err = ParseZombieType(fs.Arg(2)); err == nil {
+				err = actions.SpawnZombie(cell[0], cell[1], t)
+			}
+		}
+	case fs.NArg() == 1 && fs.Arg(0) == "clear-zombies":
+		result["removed"], err = actions.ClearZombies()
+	default:
+		fs.Usage()
+		return 2
+	}
+	if err != nil {
+		return printError(*as_json, err)
+	}
+	printResult(*as_json, result, func() {
+		if removed, ok := result["removed"]; ok {
+			fmt.Println("removed", removed)
+		} else {
+			fmt.Println("ok")
+		}
+	})
+	return 0
+}
+
+// cliScenario 应用或导出场景文件, 导出时不指定文件则输出到标准输出
+func cliScenario(args []string) int {
+	fs, as_json := newFlagSet("scenario")
+	force := fs.Bool("force", false, "apply even if the scenario is for another level")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if !AttachGame() {
+		return printError(*as_json, errors.New("游戏未运行"))
+	}
+	switch {
+	case fs.NArg() == 2 && fs.Arg(0) == "apply":
+		s, err := LoadScenario(fs.Arg(1))
+		if err == nil {
+			err = ApplyScenario(NewActions(), s, *force)
+		}
+		if err != nil {
+			return printError(*as_json, err)
+		}
+		printResult(*as_json, map[string]interface{}{"plants": len(s.Plants), "zombies": len(s.Zombies)}, func() {
+			fmt.Printf("applied %d plants, %d zombies\n", len(s.Plants), len(s.Zombies))
+		})
+	case (fs.NArg() == 1 || fs.NArg() == 2) && fs.Arg(0) == "export":
+		s, err := ExportScenario(pvz)
+		if err != nil {
+			return printError(*as_json, err)
+		}
+		if fs.NArg() == 1 {
+			data, _ := json.MarshalIndent(s, "", "  ")
+			fmt.Println(string(data))
+			return 0
+		}
+		if err := s.Save(fs.Arg(1)); err != nil {
+			return printError(*as_json, err)
+		}
+		printResult(*as_json, map[string]string{"file": fs.Arg(1)}, func() {
+			fmt.Println("exported to", fs.Arg(1))
+		})
+	default:
+		fs.Usage()
+		return 2
+	}
+	return 0
+}
+
+// cliServe 不打开窗口, 只运行本地HTTP API, 默认使用配置中的地址和令牌, 按Ctrl+C退出
+func cliServe(args []string) int {
+	fs, _ := newFlagSet("serve")
+	settings := CurrentConfig().API
+	addr := fs.String("addr", settings.Address, "listen address")
+	token := fs.String("token", settings.Token, "access token")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	settings = APISettings{Enabled: true, Address: *addr, Token: *token}
+	if err := api_service.Apply(settings); err != nil {
+		return printError(false, err)
+	}
+	defer api_service.Close()
+	fmt.Println("listening on", settings.Address)
+	pollUntilInterrupt()
+	return 0
+}
+
+// pollUntilInterrupt 监测游戏并发布事件, 按Ctrl+C后返回
+func pollUntilInterrupt() {
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt)
+	defer signal.Stop(stop)
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		PollGameEvents(AttachGame())
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// dryScriptHost 只输出动作, 不执行
+type dryScriptHost struct {
+	ScriptHost
+}
+
+func (h dryScriptHost) Do(action ScriptAction) error {
+	switch action.Type {
+	case "play":
+		fmt.Println(action.Type, action.Music.String())
+	case "notify":
+		fmt.Println(action.Type, action.Text, action.Content)
+	default:
+		fmt.Println(action.Type, action.Text)
+	}
+	return nil
+}
+
+// cliScript 检查规则脚本, 或不打开窗口运行规则, 按Ctrl+C退出
+func cliScript(args []string) int {
+	fs, as_json := newFlagSet("script")
+	dry := fs.Bool("dry", false, "print actions instead of running them")
+	rest, err := parseFlags(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(rest) != 2 || (rest[0] != "check" && rest[0] != "run") {
+		fs.Usage()
+		return 2
+	}
+	script, err := LoadScript(rest[1])
+	if err != nil {
+		return printError(*as_json, err)
+	}
+	if rest[0] == "check" {
+		rules := []map[string]interface{}{}
+		for _, rule := range script.Rules {
+			rules = append(rules, map[string]interface{}{"line": rule.Line, "event": rule.Event})
+		}
+		printResult(*as_json, rules, func() {
+			for _, rule := range script.Rules {
+				fmt.Printf("line %d: on %s\n", rule.Line, rule.Event)
+			}
+		})
+		return 0
+	}
+
+	var host ScriptHost = &gameScriptHost{}
+	if *dry {
+		host = dryScriptHost{host}
+	}
+	engine := NewScriptEngine(host)
+	if err := engine.Reload(rest[1]); err != nil {
+		return printError(*as_json, err)
+	}
+	stop := engine.Run(game_events)
+	defer stop()
+	pollUntilInterrupt()
+	return 0
+}
+
+// cliHistory 输出历史统计, 或导出为CSV
+func cliHistory(args []string) int {
+	fs, as_json := newFlagSet("history")
+	levels := fs.Bool("levels", false, "export per-level statistics instead of events")
+	rest, err := parseFlags(fs, args)
+	if err != nil {
+		return 2
+	}
+	events, err := ReadHistory(HistoryPath())
+	if err != nil {
+		return printError(*as_json, err)
+	}
+	stats := ComputeStats(events)
+	switch {
+	case len(rest) == 0:
+		printResult(*as_json, stats, func() {
+			for _, line := range stats.Summary() {
+				fmt.Println(line)
+			}
+			for _, l := range stats.Levels {
+				fmt.Printf("mode %d level %d: %d started, %d completed, %d failed, %d exited, best %ds\n",
+					l.GameMode, l.Level, l.Started, l.Completed, l.Failed, l.Exited, l.BestSeconds)
+			}
+		})
+	case (len(rest) == 1 || len(rest) == 2) && rest[0] == "export":
+		out := os.Stdout
+		if len(rest) == 2 {
+			f, err := os.Create(rest[1])
+			if err != nil {
+				return printError(*as_json, err)
+			}
+			defer f.Close()
+			out = f
+		}
+		if *levels {
+			err = ExportLevelStatsCSV(out, stats)
+		} else {
+			err = ExportHistoryCSV(out, events)
+		}
+		if err != nil {
+			return printError(*as_json, err)
+		}
+	default:
+		fs.Usage()
+		return 2
+	}
+	return 0
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestParseFlags(t *testing.T) {
+	for _, args := range [][]string{
+		{"-dry", "run", "rules.txt"},
+		{"run", "-dry", "rules.txt"},
+		{"run", "rules.txt", "-dry"},
+	} {
+		fs := flag.NewFlagSet("script", flag.ContinueOnError)
+		dry := fs.Bool("dry", false, "")
+		rest, err := parseFlags(fs, args)
+		if err != nil || !*dry || !reflect.DeepEqual(rest, []string{"run", "rules.txt"}) {
+			t.Errorf("parseFlags(%q) = %q, %v, dry = %v", args, rest, err, *dry)
+		}
+	}
+
+	fs := flag.NewFlagSet("history", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	if _, err := parseFlags(fs, []string{"export", "-unknown"}); err == nil {
+		t.Error("expected error for an unknown flag after the subcommand")
+	}
+}
@@ -0,0 +1,423 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+	"github.com/fsnotify/fsnotify"
+)
+
+// @title: Config
+// @description: 配置, 保存在用户配置目录下的 pvzHE_utils/config.json
+type Config struct {
+	// 是否自动保存
+	AutoSave bool `json:"auto_save"`
+	// 自动保存间隔(秒)
+	AutoSaveInterval int `json:"auto_save_interval"`
+	// 游戏写入存档后是否自动备份
+	BackupOnSave bool `json:"backup_on_save"`
+	// 最多保留的备份数量
+	MaxBackups int `json:"max_backups"`
+	// 备份目录
+	BackupDir string `json:"backup_dir"`
+	// 游戏存档目录
+	DataDir string `json:"data_dir"`
+	// 游戏窗口标题
+	GameTitle string `json:"game_title"`
+	// 关闭窗口时最小化到托盘
+	MinimizeToTray bool `json:"minimize_to_tray"`
+	// 启动时只显示托盘图标
+	StartMinimized bool `json:"start_minimized"`
+	// 桌面通知
+	Notify NotifySettings `json:"notify"`
+	// 全局热键, 动作名到热键, 为空时不使用
+	Hotkeys map[string]string `json:"hotkeys"`
+	// 锁定的音乐, 为0时不锁定
+	LockedMusic MusicID `json:"locked_music,omitempty"`
+	// 版本配置文件, 补充杂交版新增的植物和僵尸名称, 为空时使用内置名称
+	VersionProfile string `json:"version_profile,omitempty"`
+	// 其他存档配置
+	Profiles []SaveProfile `json:"profiles,omitempty"`
+	// 当前使用的存档配置, 为空时使用default
+	ActiveProfile string `json:"active_profile,omitempty"`
+	// 本地HTTP API
+	API APISettings `json:"api"`
+	// 自动化规则脚本, 为空时不使用
+	Script string `json:"script,omitempty"`
+}
+
+// 当前配置
+var config = DefaultConfig()
+var configLock sync.Mutex
+
+// 配置被重新加载后的回调, 用于刷新界面
+var on_config_change = func(c Config) {}
+
+// @title: DefaultConfig
+// @description: 默认配置
+// @return: Config
+func DefaultConfig() Config {
+	return Config{
+		AutoSave:         false,
+		AutoSaveInterval: 30,
+		MaxBackups:       10,
+		BackupDir:        "backup",
+		DataDir:          DefaultDataDir(),
+		GameTitle:        "植物大战僵尸杂交版",
+		// 自动保存的备份很频繁, 默认只通知失败和恢复
+		Notify: NotifySettings{BackupFailed: true, Restore: true},
+		Hotkeys: map[string]string{
+			HotkeyBackup:        "F5",
+			HotkeyRestoreLatest: "F9",
+		},
+		API: APISettings{Address: DefaultAPIAddress},
+	}
+}
+
+// @title: Config::Validate
+// @description: 检查配置是否合法
+// @return: error
+func (c Config) Validate() error {
+	if c.AutoSaveInterval < 5 {
+		return errors.New("auto_save_interval 不能小于5秒")
+	}
+	if c.MaxBackups < 1 {
+		return errors.New("max_backups 不能小于1")
+	}
+	if c.BackupDir == "" {
+		return errors.New("backup_dir 不能为空")
+	}
+	if c.DataDir == "" {
+		return errors.New("data_dir 不能为空")
+	}
+	if c.GameTitle == "" {
+		return errors.New("game_title 不能为空")
+	}
+	for action, spec := range c.Hotkeys {
+		if _, ok := HotkeyActions()[action]; !ok {
+			return fmt.Errorf("未知的热键动作 %s", action)
+		}
+		if spec == "" {
+			continue
+		}
+		if _, err := ParseHotkey(spec); err != nil {
+			return err
+		}
+	}
+	if err := c.API.Validate(); err != nil {
+		return err
+	}
+	return c.validateProfiles()
+}
+
+// @title: ConfigPath
+// @description: 配置文件路径
+// @return: string
+func ConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		dir = "."
+	}
+	return filepath.Join(dir, "pvzHE_utils", "config.json")
+}
+
+// @title: ParseConfig
+// @description: 解析配置, 缺少的字段使用默认值, 不允许未知字段
+// @param: data []byte 配置文件内容
+// @return: Config, error
+func ParseConfig(data []byte) (Config, error) {
+	c := DefaultConfig()
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&c); err != nil {
+		return c, fmt.Errorf("配置文件格式错误: %v", err)
+	}
+	if err := c.Validate(); err != nil {
+		return c, err
+	}
+	return c, nil
+}
+
+// @title: LoadConfig
+// @description: 读取配置文件并应用, 配置文件不存在时写入默认配置
+// @return: error
+func LoadConfig() error {
+	data, err := os.ReadFile(ConfigPath())
+	if os.IsNotExist(err) {
+		return SaveConfig(DefaultConfig())
+	}
+	if err != nil {
+		return err
+	}
+	c, err := ParseConfig(data)
+	if err != nil {
+		return err
+	}
+	ApplyConfig(c)
+	return nil
+}
+
+// @title: SaveConfig
+// @description: 检查并保存配置, 保存后立即应用
+// @param: c Config 配置
+// @return: error
+func SaveConfig(c Config) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := MakeDir(filepath.Dir(ConfigPath())); err != nil {
+		return err
+	}
+	if err := os.WriteFile(ConfigPath(), data, 0666); err != nil {
+		return err
+	}
+	ApplyConfig(c)
+	return nil
+}
+
+// @title: ApplyConfig
+// @description: 应用配置
+// @param: c Config 配置
+func ApplyConfig(c Config) {
+	configLock.Lock()
+	config = c
+	configLock.Unlock()
+
+	// 存档和备份相关的设置由当前存档配置决定
+	p := c.Profile()
+	auto_save = c.AutoSave
+	backup_on_save = c.BackupOnSave
+	auto_save_interval = time.Duration(c.AutoSaveInterval) * time.Second
+	max_backups = p.MaxBackups
+	backup_path = p.BackupDir
+	data_path = p.DataDir
+	game_title = c.GameTitle
+	music.Lock(c.LockedMusic)
+	version_profile = DefaultVersionProfile()
+	if c.VersionProfile != "" {
+		if v, err := LoadVersionProfile(c.VersionProfile); err != nil {
+			log.Println("读取版本配置失败:", err)
+		} else {
+			version_profile = v
+		}
+	}
+
+	// 备份目录或存档目录变化后重新监听
+	backup_index.retarget(backup_path, data_path)
+}
+
+// @title: CurrentConfig
+// @description: 获取当前配置
+// @return: Config
+func CurrentConfig() Config {
+	configLock.Lock()
+	defer configLock.Unlock()
+	return config
+}
+
+// @title: UpdateConfig
+// @description: 修改当前配置并保存, 保存后刷新界面
+// @param: update func(*Config) 修改操作
+// @return: error
+func UpdateConfig(update func(c *Config)) error {
+	c := CurrentConfig()
+	update(&c)
+	if err := SaveConfig(c); err != nil {
+		return err
+	}
+	on_config_change(c)
+	return nil
+}
+
+// @title: WatchConfig
+// @description: 监听配置文件, 被外部修改时重新加载
+// @return: error
+func WatchConfig() error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	// 编辑器保存时可能会替换文件, 因此监听所在目录
+	if err := watcher.Add(filepath.Dir(ConfigPath())); err != nil {
+		watcher.Close()
+		return err
+	}
+
+	go func() {
+		defer watcher.Close()
+		// 合并短时间内的多次修改
+		var timer *time.Timer
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Base(event.Name) != filepath.Base(ConfigPath()) || event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) == 0 {
+					continue
+				}
+				if timer != nil {
+					timer.Stop()
+				}
+				timer = time.AfterFunc(200*time.Millisecond, func() {
+					old := CurrentConfig()
+					if err := LoadConfig(); err != nil {
+						log.Println("重新加载配置失败:", err)
+						return
+					}
+					if c := CurrentConfig(); !reflect.DeepEqual(c, old) {
+						on_config_change(c)
+					}
+				})
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Println("监听配置文件失败:", err)
+			}
+		}
+	}()
+	return nil
+}
+
+// @title: NewSettingsTab
+// @description: 设置页
+// @param: w fyne.Window 父窗口
+// @return: fyne.CanvasObject, func(Config) 配置变化时刷新设置页
+func NewSettingsTab(w fyne.Window) (fyne.CanvasObject, func(Config)) {
+	data_entry := widget.NewEntry()
+	backup_entry := widget.NewEntry()
+	title_entry := widget.NewEntry()
+	interval_entry := widget.NewEntry()
+	max_entry := widget.NewEntry()
+	on_save_check := widget.NewCheck("backup when the game saves", nil)
+	tray_check := widget.NewCheck("minimize to tray on close", nil)
+	minimized_check := widget.NewCheck("start minimized to tray", nil)
+	notify_backup_check := widget.NewCheck("backup completed", nil)
+	notify_failed_check := widget.NewCheck("backup failed", nil)
+	notify_restore_check := widget.NewCheck("restore", nil)
+	notify_game_check := widget.NewCheck("game started / exited", nil)
+	backup_key_entry := widget.NewEntry()
+	backup_key_entry.SetPlaceHolder("e.g. F5, Ctrl+S")
+	restore_key_entry := widget.NewEntry()
+	api_check := widget.NewCheck("enable local HTTP API", nil)
+	api_address_entry := widget.NewEntry()
+	api_token_entry := widget.NewEntry()
+	api_token_button := widget.NewButton("generate", func() {
+		api_token_entry.SetText(NewAPIToken())
+	})
+
+	refresh := func(c Config) {
+		on_save_check.SetChecked(c.BackupOnSave)
+		tray_check.SetChecked(c.MinimizeToTray)
+		minimized_check.SetChecked(c.StartMinimized)
+		notify_backup_check.SetChecked(c.Notify.Backup)
+		notify_failed_check.SetChecked(c.Notify.BackupFailed)
+		notify_restore_check.SetChecked(c.Notify.Restore)
+		notify_game_check.SetChecked(c.Notify.Game)
+		backup_key_entry.SetText(c.Hotkeys[HotkeyBackup])
+		restore_key_entry.SetText(c.Hotkeys[HotkeyRestoreLatest])
+		api_check.SetChecked(c.API.Enabled)
+		api_address_entry.SetText(c.API.Address)
+		api_token_entry.SetText(c.API.Token)
+		data_entry.SetText(c.DataDir)
+		backup_entry.SetText(c.BackupDir)
+		title_entry.SetText(c.GameTitle)
+		interval_entry.SetText(strconv.Itoa(c.AutoSaveInterval))
+		max_entry.SetText(strconv.Itoa(c.MaxBackups))
+	}
+	refresh(CurrentConfig())
+
+	save_button := widget.NewButton("save", func() {
+		interval, err := strconv.Atoi(interval_entry.Text)
+		if err != nil {
+			dialog.NewInformation("Error", "Interval must be a number.", w).Show()
+			return
+		}
+		max, err := strconv.Atoi(max_entry.Text)
+		if err != nil {
+			dialog.NewInformation("Error", "Max backups must be a number.", w).Show()
+			return
+		}
+		err = UpdateConfig(func(c *Config) {
+			c.DataDir = data_entry.Text
+			c.BackupDir = backup_entry.Text
+			c.GameTitle = title_entry.Text
+			c.AutoSaveInterval = interval
+			c.MaxBackups = max
+			c.BackupOnSave = on_save_check.Checked
+			c.MinimizeToTray = tray_check.Checked
+			c.StartMinimized = minimized_check.Checked
+			c.Notify = NotifySettings{
+				Backup:       notify_backup_check.Checked,
+				BackupFailed: notify_failed_check.Checked,
+				Restore:      notify_restore_check.Checked,
+				Game:         notify_game_check.Checked,
+			}
+			c.Hotkeys = map[string]string{
+				HotkeyBackup:        backup_key_entry.Text,
+				HotkeyRestoreLatest: restore_key_entry.Text,
+			}
+			c.API = APISettings{
+				Enabled: api_check.Checked,
+				Address: api_address_entry.Text,
+				Token:   api_token_entry.Text,
+			}
+		})
+		if err != nil {
+			dialog.NewInformation("Error", err.Error(), w).Show()
+			return
+		}
+		MakeDir(backup_path)
+		dialog.NewInformation("Success", "Settings saved", w).Show()
+	})
+
+	detect_button := widget.NewButton("detect", func() {
+		ShowDataDirPicker(w, data_entry.SetText)
+	})
+
+	form := widget.NewForm(
+		widget.NewFormItem("data dir", container.NewBorder(nil, nil, nil, detect_button, data_entry)),
+		widget.NewFormItem("backup dir", backup_entry),
+		widget.NewFormItem("game title", title_entry),
+		widget.NewFormItem("interval (s)", interval_entry),
+		widget.NewFormItem("max backups", max_entry),
+		widget.NewFormItem("backup key", backup_key_entry),
+		widget.NewFormItem("restore key", restore_key_entry),
+	)
+	return container.NewVScroll(container.NewVBox(
+		form,
+		on_save_check,
+		tray_check,
+		minimized_check,
+		widget.NewCard("", "notifications", container.NewGridWithColumns(2,
+			notify_backup_check, notify_failed_check, notify_restore_check, notify_game_check,
+		)),
+		widget.NewCard("", "local API", container.NewVBox(
+			api_check,
+			widget.NewForm(
+				widget.NewFormItem("address", api_address_entry),
+				widget.NewFormItem("token", container.NewBorder(nil, nil, nil, api_token_button, api_token_entry)),
+			),
+		)),
+		save_button,
+		widget.NewLabel(ConfigPath()),
+	)), refresh
+}
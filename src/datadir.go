@@ -0,0 +1,136 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+	"golang.org/x/sys/windows"
+)
+
+// 存档目录在ProgramData下的相对路径, 依次为杂交版和原版
+var dataDirSuffixes = [][]string{
+	{"PopCap Games", "PlantsVsZombies", "pvzHE", "yourdata"},
+	{"PopCap Games", "PlantsVsZombies", "userdata"},
+}
+
+// @title: DefaultDataDir
+// @description: 默认的存档目录
+// @return: string
+func DefaultDataDir() string {
+	return filepath.Join(append([]string{programDataDir()}, dataDirSuffixes[0]...)...)
+}
+
+// programDataDir ProgramData目录
+func programDataDir() string {
+	if dir := os.Getenv("ProgramData"); dir != "" {
+		return dir
+	}
+	return filepath.Join("C:"+string(filepath.Separator), "ProgramData")
+}
+
+// @title: DataDirCandidates
+// @description: 查找可能的存档目录, 只返回存在的目录
+// @return: []string
+func DataDirCandidates() []string {
+	// 可能的ProgramData目录
+	roots := []string{programDataDir()}
+	// 没有管理员权限时写入会被重定向到VirtualStore
+	if local := os.Getenv("LOCALAPPDATA"); local != "" {
+		roots = append(roots, filepath.Join(local, "VirtualStore", "ProgramData"))
+	}
+	// Wine和Proton的前缀
+	if home, err := os.UserHomeDir(); err == nil {
+		roots = append(roots, filepath.Join(home, ".wine", "drive_c", "ProgramData"))
+		for _, steam := range []string{
+			filepath.Join(home, ".steam", "steam"),
+			filepath.Join(home, ".local", "share", "Steam"),
+		} {
+			prefixes, _ := filepath.Glob(filepath.Join(steam, "steamapps", "compatdata", "*", "pfx", "drive_c", "ProgramData"))
+			roots = append(roots, prefixes...)
+		}
+	}
+
+	candidates := []string{}
+	for _, root := range roots {
+		for _, suffix := range dataDirSuffixes {
+			candidates = append(candidates, filepath.Join(append([]string{root}, suffix...)...))
+		}
+	}
+
+	// 便携版的存档在游戏目录下
+	game_dirs := []string{}
+	if wd, err := os.Getwd(); err == nil {
+		game_dirs = append(game_dirs, wd)
+	}
+	if dir := gameExeDir(); dir != "" {
+		game_dirs = append(game_dirs, dir)
+	}
+	for _, dir := range game_dirs {
+		candidates = append(candidates, filepath.Join(dir, "yourdata"), filepath.Join(dir, "userdata"))
+	}
+
+	found := []string{}
+	seen := map[string]bool{}
+	for _, dir := range candidates {
+		dir = filepath.Clean(dir)
+		if seen[dir] || !IsDir(dir) {
+			continue
+		}
+		seen[dir] = true
+		found = append(found, dir)
+	}
+	return found
+}
+
+// gameExeDir 正在运行的游戏所在目录, 游戏未运行时返回空
+// 启动时查找存档目录还没有连接游戏, 需要先连接
+func gameExeDir() string {
+	if !AttachGame() || !pvz.IsValid() {
+		return ""
+	}
+	buf := make([]uint16, windows.MAX_PATH)
+	size := uint32(len(buf))
+	if err := windows.QueryFullProcessImageName(windows.Handle(pvz.ProcessHandle), 0, &buf[0], &size); err != nil {
+		return ""
+	}
+	return filepath.Dir(syscall.UTF16ToString(buf[:size]))
+}
+
+// @title: ResolveDataDir
+// @description: 配置的存档目录不存在时, 使用找到的第一个存档目录
+// @param: configured string 配置的存档目录
+// @return: string 存档目录, bool 是否与配置不同
+func ResolveDataDir(configured string) (string, bool) {
+	if IsDir(configured) {
+		return configured, false
+	}
+	if candidates := DataDirCandidates(); len(candidates) > 0 {
+		return candidates[0], true
+	}
+	return configured, false
+}
+
+// @title: ShowDataDirPicker
+// @description: 弹出找到的存档目录供用户选择
+// @param: w fyne.Window 父窗口
+// @param: picked func(string) 选择后的回调
+func ShowDataDirPicker(w fyne.Window, picked func(dir string)) {
+	candidates := DataDirCandidates()
+	if len(candidates) == 0 {
+		dialog.NewInformation("Detect", "No save data directory found.", w).Show()
+		return
+	}
+	radio := widget.NewRadioGroup(candidates, nil)
+	radio.SetSelected(candidates[0])
+	d := dialog.NewCustomConfirm("Save data directory", "Use", "Cancel", radio, func(ok bool) {
+		if ok && radio.Selected != "" {
+			picked(radio.Selected)
+		}
+	}, w)
+	d.Resize(fyne.NewSize(480, 240))
+	d.Show()
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// 两个快照之间单个文件的差异类型
+const (
+	DiffAdded   = "+" // 只存在于新快照
+	DiffRemoved = "-" // 只存在于旧快照
+	DiffChanged = "~" // 两边都存在但内容不同
+)
+
+// 表示当前存档的快照名
+const LiveSnapshot = "live"
+
+// @title: FileDiff
+// @description: 单个文件的差异
+type FileDiff struct {
+	// 相对路径
+	Name string
+	// 差异类型
+	Kind string
+	// 旧/新文件大小, 不存在时为-1
+	OldSize int64
+	NewSize int64
+	// 语义差异, 只对能解析的存档格式有效
+	Details []string
+}
+
+// @title: SnapshotPath
+// @description: 将快照名转换为目录, live表示当前存档, 其余为backup下的备份
+// @param: name string 快照名
+// @return: string
+func SnapshotPath(name string) string {
+	if name == LiveSnapshot {
+		return data_path
+	}
+	return BackupDir(name)
+}
+
+// @title: DiffDirs
+// @description: 比较两个目录中的文件, 对已知的存档格式给出语义差异
+// @param: oldDir string 旧目录
+// @param: newDir string 新目录
+// @return: []FileDiff, error
+func DiffDirs(oldDir, newDir string) ([]FileDiff, error) {
+	oldFiles, err := listFiles(oldDir)
+	if err != nil {
+		return nil, err
+	}
+	newFiles, err := listFiles(newDir)
+	if err != nil {
+		return nil, err
+	}
+
+	diffs := []FileDiff{}
+	for name, oldSize := range oldFiles {
+		newSize, ok := newFiles[name]
+		if !ok {
+			diffs = append(diffs, FileDiff{Name: name, Kind: DiffRemoved, OldSize: oldSize, NewSize: -1})
+			continue
+		}
+		oldData, err := os.ReadFile(filepath.Join(oldDir, name))
+		if err != nil {
+			return nil, err
+		}
+		newData, err := os.ReadFile(filepath.Join(newDir, name))
+		if err != nil {
+			return nil, err
+		}
+		if bytes.Equal(oldData, newData) {
+			continue
+		}
+		diffs = append(diffs, FileDiff{
+			Name:    name,
+			Kind:    DiffChanged,
+			OldSize: oldSize,
+			NewSize: newSize,
+			Details: diffSaveData(name, oldData, newData),
+		})
+	}
+	for name, newSize := range newFiles {
+		if _, ok := oldFiles[name]; !ok {
+			diffs = append(diffs, FileDiff{Name: name, Kind: DiffAdded, OldSize: -1, NewSize: newSize})
+		}
+	}
+
+	sort.Slice(diffs, func(i, j int) bool {
+		return diffs[i].Name < diffs[j].Name
+	})
+	return diffs, nil
+}
+
+// @title: FormatDiff
+// @description: 将差异格式化为文本
+// @param: diffs []FileDiff 差异
+// @return: string
+func FormatDiff(diffs []FileDiff) string {
+	if len(diffs) == 0 {
+		return "No differences."
+	}
+	var sb strings.Builder
+	for _, d := range diffs {
+		switch d.Kind {
+		case DiffAdded:
+			fmt.Fprintf(&sb, "%s %s (%s)\n", d.Kind, d.Name, FormatSize(d.NewSize))
+		case DiffRemoved:
+			fmt.Fprintf(&sb, "%s %s (%s)\n", d.Kind, d.Name, FormatSize(d.OldSize))
+		default:
+			fmt.Fprintf(&sb, "%s %s (%s -> %s)\n", d.Kind, d.Name, FormatSize(d.OldSize), FormatSize(d.NewSize))
+		}
+		for _, detail := range d.Details {
+			fmt.Fprintf(&sb, "    %s\n", detail)
+		}
+	}
+	return sb.String()
+}
+
+// listFiles 列出目录下所有文件的相对路径和大小
+func listFiles(dir string) (map[string]int64, error) {
+	if !IsDir(dir) {
+		return nil, fmt.Errorf("%s 不是一个正确的目录！", dir)
+	}
+	files := map[string]int64{}
+	err := filepath.Walk(dir, func(path string, f os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if f.IsDir() {
+			return nil
+		}
+		name, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if name == backupMetaFile {
+			return nil
+		}
+		files[name] = f.Size()
+		return nil
+	})
+	return files, err
+}
+
+var userDataPattern = regexp.MustCompile(`(?i)^user\d+\.dat$`)
+
+// diffSaveData 对已知格式的存档文件给出语义差异, 未知格式返回nil
+func diffSaveData(name string, oldData, newData []byte) []string {
+	base := filepath.Base(name)
+	switch {
+	case userDataPattern.MatchString(base):
+		oldUser, err := ParseUserData(oldData)
+		if err != nil {
+			return []string{"old: " + err.Error()}
+		}
+		newUser, err := ParseUserData(newData)
+		if err != nil {
+			return []string{"new: " + err.Error()}
+		}
+		return diffUserData(oldUser, newUser)
+	case strings.EqualFold(base, "users.dat"):
+		oldUsers, err := ParseUsersFile(oldData)
+		if err != nil {
+			return []string{"old: " + err.Error()}
+		}
+		newUsers, err := ParseUsersFile(newData)
+		if err != nil {
+			return []string{"new: " + err.Error()}
+		}
+		return diffUsersFile(oldUsers, newUsers)
+	case gameSavePattern.MatchString(base):
+		oldSave, err := ParseSaveGame(oldData)
+		if err != nil {
+			return []string{"old: " + err.Error()}
+		}
+		newSave, err := ParseSaveGame(newData)
+		if err != nil {
+			return []string{"new: " + err.Error()}
+		}
+		return diffSaveGame(oldSave, newSave)
+	}
+	return nil
+}
+
+// diffUserData 比较两个用户存档的字段
+func diffUserData(u, other *UserData) []string {
+	details := []string{}
+	if u.Level != other.Level {
+		details = append(details, fmt.Sprintf("adventure level: %s -> %s", u.AdventureLevel(), other.AdventureLevel()))
+	}
+	if u.FinishedAdventure != other.FinishedAdventure {
+		details = append(details, fmt.Sprintf("adventure finished: %d -> %d", u.FinishedAdventure, other.FinishedAdventure))
+	}
+	if u.Coins != other.Coins {
+		// 存档中的金币为显示值的1/10
+		details = append(details, fmt.Sprintf("coins: %d -> %d", u.Coins*10, other.Coins*10))
+	}
+	for i, name := range purchasePlantNames {
+		if u.PlantPurchased(i) != other.PlantPurchased(i) {
+			if other.PlantPurchased(i) {
+				details = append(details, "unlocked plant: +"+name)
+			} else {
+				details = append(details, "unlocked plant: -"+name)
+			}
+		}
+	}
+	for i := len(purchasePlantNames); i < userPurchaseCount; i++ {
+		if u.Purchases[i] != other.Purchases[i] {
+			details = append(details, fmt.Sprintf("purchase %d: %d -> %d", i, u.Purchases[i], other.Purchases[i]))
+		}
+	}
+	for i := 0; i < userChallengeCount; i++ {
+		if u.ChallengeRecords[i] != other.ChallengeRecords[i] {
+			details = append(details, fmt.Sprintf("mode %d record: %d -> %d", i+1, u.ChallengeRecords[i], other.ChallengeRecords[i]))
+		}
+	}
+	if u.HasUnlockedMinigames != other.HasUnlockedMinigames {
+		details = append(details, fmt.Sprintf("mini-games unlocked: %d -> %d", u.HasUnlockedMinigames, other.HasUnlockedMinigames))
+	}
+	if u.HasUnlockedPuzzleMode != other.HasUnlockedPuzzleMode {
+		details = append(details, fmt.Sprintf("puzzle unlocked: %d -> %d", u.HasUnlockedPuzzleMode, other.HasUnlockedPuzzleMode))
+	}
+	if u.HasUnlockedSurvivalMode != other.HasUnlockedSurvivalMode {
+		details = append(details, fmt.Sprintf("survival unlocked: %d -> %d", u.HasUnlockedSurvivalMode, other.HasUnlockedSurvivalMode))
+	}
+	if len(u.PottedPlants) != len(other.PottedPlants) {
+		details = append(details, fmt.Sprintf("zen garden plants: %d -> %d", len(u.PottedPlants), len(other.PottedPlants)))
+	}
+	for i, name := range achievementNames {
+		if u.AchievementEarned(i) != other.AchievementEarned(i) {
+			if other.AchievementEarned(i) {
+				details = append(details, "achievement: +"+name)
+			} else {
+				details = append(details, "achievement: -"+name)
+			}
+		}
+	}
+	return details
+}
+
+// diffUsersFile 比较两个用户列表
+func diffUsersFile(f, other *UsersFile) []string {
+	details := []string{}
+	users := map[int32]UserEntry{}
+	for _, u := range f.Users {
+		users[u.ID] = u
+	}
+	for _, u := range other.Users {
+		old, ok := users[u.ID]
+		if !ok {
+			details = append(details, fmt.Sprintf("user: +%s (user%d.dat)", u.Name, u.ID))
+		} else if old.Name != u.Name {
+			details = append(details, fmt.Sprintf("user%d.dat renamed: %s -> %s", u.ID, old.Name, u.Name))
+		}
+		delete(users, u.ID)
+	}
+	for _, u := range users {
+		details = append(details, fmt.Sprintf("user: -%s (user%d.dat)", u.Name, u.ID))
+	}
+	return details
+}
+
+// @title: ShowDiff
+// @description: 弹出快照比较窗口
+// @param: w fyne.Window 父窗口
+func ShowDiff(w fyne.Window) {
+	options := append([]string{LiveSnapshot}, backup_list...)
+	old_select := widget.NewSelect(options, nil)
+	new_select := widget.NewSelect(options, nil)
+	if select_backup != "" {
+		old_select.SetSelected(select_backup)
+	}
+	new_select.SetSelected(LiveSnapshot)
+
+	result := widget.NewLabel("")
+	result.Wrapping = fyne.TextWrapWord
+	compare_button := widget.NewButton("compare", func() {
+		if old_select.Selected == "" || new_select.Selected == "" {
+			return
+		}
+		diffs, err := DiffDirs(SnapshotPath(old_select.Selected), SnapshotPath(new_select.Selected))
+		if err != nil {
+			result.SetText(err.Error())
+			return
+		}
+		result.SetText(FormatDiff(diffs))
+	})
+
+	top := container.NewVBox(
+		widget.NewForm(
+			widget.NewFormItem("old", old_select),
+			widget.NewFormItem("new", new_select),
+		),
+		compare_button,
+	)
+	d := dialog.NewCustom("Diff", "Close", container.NewBorder(top, nil, nil, nil, container.NewVScroll(result)), w)
+	d.Resize(fyne.NewSize(560, 420))
+	d.Show()
+}
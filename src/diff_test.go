@@ -0,0 +1,87 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeTestFiles(t *testing.T, dir string, files map[string][]byte) {
+	t.Helper()
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestDiffDirs(t *testing.T) {
+	user := readTestData(t, "user1.dat")
+	u, err := ParseUserData(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u.Coins += 5
+	u.Purchases[2] = 1
+	changed := u.Encode()
+
+	old_dir, new_dir := t.TempDir(), t.TempDir()
+	writeTestFiles(t, old_dir, map[string][]byte{
+		"users.dat":    readTestData(t, "users.dat"),
+		"user1.dat":    user,
+		"notes.txt":    []byte("old"),
+		"removed.dat":  []byte("gone"),
+		backupMetaFile: []byte("{}"),
+	})
+	writeTestFiles(t, new_dir, map[string][]byte{
+		"users.dat":     readTestData(t, "users.dat"),
+		"user1.dat":     changed,
+		"notes.txt":     []byte("new!"),
+		"sub/added.dat": []byte("new file"),
+	})
+
+	diffs, err := DiffDirs(old_dir, new_dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []FileDiff{
+		{Name: "notes.txt", Kind: DiffChanged, OldSize: 3, NewSize: 4},
+		{Name: "removed.dat", Kind: DiffRemoved, OldSize: 4, NewSize: -1},
+		{Name: filepath.Join("sub", "added.dat"), Kind: DiffAdded, OldSize: -1, NewSize: 8},
+		{Name: "user1.dat", Kind: DiffChanged, OldSize: int64(len(user)), NewSize: int64(len(changed)), Details: []string{
+			// 金币显示为存档中数值的10倍
+			"coins: 25000 -> 25050",
+			"unlocked plant: +Gloom-shroom",
+		}},
+	}
+	if !reflect.DeepEqual(diffs, want) {
+		t.Fatalf("diffs = %+v\nwant %+v", diffs, want)
+	}
+
+	text := FormatDiff(diffs)
+	for _, line := range []string{"~ user1.dat (1016 B -> 1016 B)", "    coins: 25000 -> 25050", "- removed.dat (4 B)", "+ " + filepath.Join("sub", "added.dat") + " (8 B)"} {
+		if !strings.Contains(text, line+"\n") {
+			t.Fatalf("FormatDiff missing %q:\n%s", line, text)
+		}
+	}
+	if FormatDiff(nil) != "No differences." {
+		t.Fatal("FormatDiff(nil) should report no differences")
+	}
+}
+
+func TestDiffSaveDataUnparsable(t *testing.T) {
+	// 无法解析的存档给出错误而不是字段差异
+	got := diffSaveData("user1.dat", []byte{1, 2, 3}, readTestData(t, "user1.dat"))
+	if len(got) != 1 || !strings.HasPrefix(got[0], "old: ") {
+		t.Fatalf("details = %q", got)
+	}
+	if got := diffSaveData("notes.txt", []byte("a"), []byte("b")); got != nil {
+		t.Fatalf("details for an unknown file = %q", got)
+	}
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// 用户存档中禅境花园之前的固定部分长度
+const userFixedSize = 4 * (4 + userChallengeCount + userPurchaseCount + 20)
+
+// @title: UserDataPath
+// @description: 用户存档文件路径
+// @param: id int 用户ID
+// @return: string
+func UserDataPath(id int) string {
+	return filepath.Join(data_path, fmt.Sprintf("user%d.dat", id))
+}
+
+// @title: ListUsers
+// @description: 读取当前存档中的用户列表
+// @return: []UserEntry, error
+func ListUsers() ([]UserEntry, error) {
+	f, err := LoadUsersFile(filepath.Join(data_path, "users.dat"))
+	if err != nil {
+		return nil, err
+	}
+	return f.Users, nil
+}
+
+// @title: EditUserData
+// @description: 修改用户存档, 修改前先备份, 写入前检查结果能被重新解析
+// @param: id int 用户ID
+// @param: edit func(*UserData) error 修改操作
+// @return: string 修改前的备份名, error
+func EditUserData(id int, edit func(u *UserData) error) (string, error) {
+	return editUserFile(id, ParseUserData, edit)
+}
+
+// @title: RepairUserData
+// @description: 修复损坏的用户存档, 截断或补齐到固定部分并修正不合理的数值, 禅境花园和成就数据会被丢弃
+// @param: id int 用户ID
+// @return: string 修改前的备份名, error
+func RepairUserData(id int) (string, error) {
+	return editUserFile(id, parseDamagedUserData, repairUserData)
+}
+
+// parseDamagedUserData 解析损坏的用户存档, 无法解析时只保留禅境花园之前的固定部分
+func parseDamagedUserData(data []byte) (*UserData, error) {
+	if u, err := ParseUserData(data); err == nil {
+		return u, nil
+	}
+	// 固定部分之后补上为0的禅境花园植物数量
+	fixed := make([]byte, userFixedSize+4)
+	if len(data) > userFixedSize {
+		data = data[:userFixedSize]
+	}
+	copy(fixed, data)
+	if int32(binary.LittleEndian.Uint32(fixed)) == UserDataAchievementsVersion {
+		// 再补上未获得的成就
+		fixed = append(fixed, make([]byte, userAchievementCount)...)
+	} else {
+		binary.LittleEndian.PutUint32(fixed, UserDataVersion)
+	}
+	return ParseUserData(fixed)
+}
+
+// repairUserData 修正不合理的数值
+func repairUserData(u *UserData) error {
+	if u.Level < 1 {
+		u.Level = 1
+	}
+	if u.Coins < 0 {
+		u.Coins = 0
+	}
+	for i := range u.ChallengeRecords {
+		if u.ChallengeRecords[i] < 0 {
+			u.ChallengeRecords[i] = 0
+		}
+	}
+	return nil
+}
+
+// editUserFile 按指定的解析方式读取用户存档, 修改后写回
+func editUserFile(id int, parse func([]byte) (*UserData, error), edit func(u *UserData) error) (string, error) {
+	if CheckWindowTitle(game_title) {
+		return "", errors.New("请先关闭游戏再修改存档！")
+	}
+	return rewriteUserFile(UserDataPath(id), parse, edit)
+}
+
+// rewriteUserFile 读取path的用户存档, 修改并检查后先备份再写回
+func rewriteUserFile(path string, parse func([]byte) (*UserData, error), edit func(u *UserData) error) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	u, err := parse(data)
+	if err != nil {
+		return "", err
+	}
+	if err := edit(u); err != nil {
+		return "", err
+	}
+
+	// 检查修改后的存档能被重新解析且内容一致
+	out := u.Encode()
+	check, err := ParseUserData(out)
+	if err != nil {
+		return "", fmt.Errorf("修改后的存档无法解析: %v", err)
+	}
+	if !bytes.Equal(check.Encode(), out) {
+		return "", errors.New("修改后的存档重新编码不一致")
+	}
+
+	backup_name, err := CreateBackup(TriggerEdit)
+	if err != nil {
+		return "", err
+	}
+	defer backup_index.PauseSave()()
+	if err := os.WriteFile(path, out, 0666); err != nil {
+		return backup_name, err
+	}
+	return backup_name, nil
+}
+
+// @title: SetCoins
+// @description: 设置金币
+// @param: coins int 显示的金币数, 必须是10的倍数
+// @return: func(*UserData) error
+func SetCoins(coins int) func(u *UserData) error {
+	return func(u *UserData) error {
+		if coins < 0 || coins > 999990 || coins%10 != 0 {
+			return errors.New("金币必须是0到999990之间10的倍数！")
+		}
+		u.Coins = int32(coins / 10)
+		return nil
+	}
+}
+
+// @title: SetAdventureLevel
+// @description: 设置冒险模式关卡
+// @param: level int 关卡序号, 1-1为1, 5-10为50
+// @return: func(*UserData) error
+func SetAdventureLevel(level int) func(u *UserData) error {
+	return func(u *UserData) error {
+		if level < 1 || level > 50 {
+			return errors.New("冒险模式关卡必须在1到50之间！")
+		}
+		u.Level = int32(level)
+		return nil
+	}
+}
+
+// @title: UnlockPlants
+// @description: 解锁商店中的所有植物
+// @param: u *UserData 用户存档
+// @return: error
+func UnlockPlants(u *UserData) error {
+	for i := range purchasePlantNames {
+		if u.Purchases[i] <= 0 {
+			u.Purchases[i] = 1
+		}
+	}
+	return nil
+}
+
+// @title: UnlockMinigames
+// @description: 解锁小游戏、解谜和生存模式
+// @param: u *UserData 用户存档
+// @return: error
+func UnlockMinigames(u *UserData) error {
+	u.HasUnlockedMinigames = 1
+	u.HasUnlockedPuzzleMode = 1
+	u.HasUnlockedSurvivalMode = 1
+	return nil
+}
+
+// @title: ResetMode
+// @description: 清除某个游戏模式的完成记录
+// @param: mode int 游戏模式
+// @return: func(*UserData) error
+func ResetMode(mode int) func(u *UserData) error {
+	return func(u *UserData) error {
+		if mode < 1 || mode > userChallengeCount {
+			return fmt.Errorf("游戏模式必须在1到%d之间！", userChallengeCount)
+		}
+		u.ChallengeRecords[mode-1] = 0
+		return nil
+	}
+}
+
+// @title: NewEditorTab
+// @description: 存档编辑页
+// @param: w fyne.Window 父窗口
+// @return: fyne.CanvasObject
+func NewEditorTab(w fyne.Window) fyne.CanvasObject {
+	user_ids := map[string]int{}
+	user_select := widget.NewSelect([]string{}, nil)
+	summary_label := widget.NewLabel("")
+	summary_label.Wrapping = fyne.TextWrapWord
+
+	selected_user := func() (int, bool) {
+		id, ok := user_ids[user_select.Selected]
+		if !ok {
+			dialog.NewInformation("Error", "Please select a user.", w).Show()
+		}
+		return id, ok
+	}
+	refresh := func() {
+		id, ok := user_ids[user_select.Selected]
+		if !ok {
+			summary_label.SetText("")
+			return
+		}
+		u, err := LoadUserData(UserDataPath(id))
+		if err != nil {
+			summary_label.SetText(err.Error())
+			return
+		}
+		summary_label.SetText(fmt.Sprintf("adventure %s, coins %d, finished %d", u.AdventureLevel(), u.Coins*10, u.FinishedAdventure))
+	}
+	load_users := func() {
+		users, err := ListUsers()
+		if err != nil {
+			summary_label.SetText(err.Error())
+			return
+		}
+		options := []string{}
+		for _, u := range users {
+			text := fmt.Sprintf("%s (user%d.dat)", u.Name, u.ID)
+			user_ids[text] = int(u.ID)
+			options = append(options, text)
+		}
+		user_select.SetOptions(options)
+	}
+	user_select.OnChanged = func(string) {
+		refresh()
+	}
+
+	// 执行修改并提示结果
+	apply := func(edit func() (string, error)) {
+		backup_name, err := edit()
+		if err != nil {
+			dialog.NewInformation("Error", err.Error(), w).Show()
+			return
+		}
+		refresh()
+		dialog.NewInformation("Success", "Saved. Previous data backed up to "+backup_name, w).Show()
+	}
+
+	coins_entry := widget.NewEntry()
+	coins_entry.SetPlaceHolder("coins")
+	level_entry := widget.NewEntry()
+	level_entry.SetPlaceHolder("adventure level (1-50)")
+	mode_entry := widget.NewEntry()
+	mode_entry.SetPlaceHolder("game mode")
+
+	int_action := func(entry *widget.Entry, edit func(int) func(*UserData) error) func() {
+		return func() {
+			id, ok := selected_user()
+			if !ok {
+				return
+			}
+			v, err := strconv.Atoi(entry.Text)
+			if err != nil {
+				dialog.NewInformation("Error", "Please enter a number.", w).Show()
+				return
+			}
+			apply(func() (string, error) { return EditUserData(id, edit(v)) })
+		}
+	}
+	edit_action := func(edit func(*UserData) error) func() {
+		return func() {
+			if id, ok := selected_user(); ok {
+				apply(func() (string, error) { return EditUserData(id, edit) })
+			}
+		}
+	}
+
+	load_users()
+
+	return container.NewVScroll(container.NewVBox(
+		container.NewBorder(nil, nil, nil, widget.NewButton("reload", load_users), user_select),
+		summary_label,
+		container.NewGridWithColumns(2, coins_entry, widget.NewButton("set coins", int_action(coins_entry, SetCoins))),
+		container.NewGridWithColumns(2, level_entry, widget.NewButton("set level", int_action(level_entry, SetAdventureLevel))),
+		container.NewGridWithColumns(2, mode_entry, widget.NewButton("reset mode", int_action(mode_entry, ResetMode))),
+		container.NewGridWithColumns(2,
+			widget.NewButton("unlock plants", edit_action(UnlockPlants)),
+			widget.NewButton("unlock mini-games", edit_action(UnlockMinigames)),
+		),
+		widget.NewButton("repair", func() {
+			if id, ok := selected_user(); ok {
+				apply(func() (string, error) { return RepairUserData(id) })
+			}
+		}),
+	))
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// setupUserFile 把data写到临时存档目录的user1.dat, 备份写到临时备份目录
+func setupUserFile(t *testing.T, data []byte) string {
+	t.Helper()
+	old_backup, old_data := backup_path, data_path
+	backup_path, data_path = t.TempDir(), t.TempDir()
+	t.Cleanup(func() { backup_path, data_path = old_backup, old_data })
+	path := filepath.Join(data_path, "user1.dat")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// checkEditBackup 修改前的存档应该在备份中
+func checkEditBackup(t *testing.T, backup_name string, original []byte) {
+	t.Helper()
+	backed, err := os.ReadFile(filepath.Join(BackupDir(backup_name), "user1.dat"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(backed, original) {
+		t.Fatal("backup does not hold the original user1.dat")
+	}
+	meta, err := ReadBackupMeta(backup_name)
+	if err != nil || meta.Trigger != TriggerEdit {
+		t.Fatalf("backup meta = %+v, %v", meta, err)
+	}
+}
+
+func TestEditUserData(t *testing.T) {
+	original := readTestData(t, "user1.dat")
+	tests := []struct {
+		name  string
+		edit  func(u *UserData) error
+		check func(u *UserData) bool
+	}{
+		{"coins", SetCoins(12340), func(u *UserData) bool { return u.Coins == 1234 }},
+		{"level", SetAdventureLevel(21), func(u *UserData) bool { return u.AdventureLevel() == "3-1" }},
+		{"plants", UnlockPlants, func(u *UserData) bool {
+			for i := range purchasePlantNames {
+				if !u.PlantPurchased(i) {
+					return false
+				}
+			}
+			// 已购买的记录不变
+			return u.Purchases[0] == 1
+		}},
+		{"minigames", UnlockMinigames, func(u *UserData) bool {
+			return u.HasUnlockedMinigames == 1 && u.HasUnlockedPuzzleMode == 1 && u.HasUnlockedSurvivalMode == 1
+		}},
+		{"reset", ResetMode(16), func(u *UserData) bool { return !u.ModeCompleted(16) && u.ModeCompleted(1) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := setupUserFile(t, original)
+			backup_name, err := rewriteUserFile(path, ParseUserData, tt.edit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkEditBackup(t, backup_name, original)
+			u, err := LoadUserData(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tt.check(u) {
+				t.Fatalf("edit not applied: %+v", u)
+			}
+			// 其余数据原样保留
+			if len(u.PottedPlants) != 2 || !u.AchievementEarned(3) || u.PlayTimeActive != 36000 {
+				t.Fatalf("other data changed: %+v", u)
+			}
+		})
+	}
+}
+
+func TestEditUserDataInvalid(t *testing.T) {
+	original := readTestData(t, "user1.dat")
+	for _, edit := range []func(u *UserData) error{SetCoins(15), SetCoins(-10), SetAdventureLevel(51), ResetMode(0)} {
+		path := setupUserFile(t, original)
+		if _, err := rewriteUserFile(path, ParseUserData, edit); err == nil {
+			t.Fatal("expected error for an invalid edit")
+		}
+		// 修改不合法时不备份也不写入
+		if data, _ := os.ReadFile(path); !bytes.Equal(data, original) {
+			t.Fatal("user1.dat changed after a failed edit")
+		}
+		if backups, _ := listBackupsIn(backup_path); len(backups) != 0 {
+			t.Fatalf("backups = %d after a failed edit", len(backups))
+		}
+	}
+}
+
+func TestRepairUserData(t *testing.T) {
+	original := readTestData(t, "user1.dat")
+	// 截断在禅境花园中, 并写入不合理的关卡和金币
+	damaged := append([]byte{}, original[:userFixedSize+10]...)
+	binary.LittleEndian.PutUint32(damaged[4:], 0)
+	binary.LittleEndian.PutUint32(damaged[8:], 0xFFFFFFF6)
+	if _, err := ParseUserData(damaged); err == nil {
+		t.Fatal("damaged file should not parse")
+	}
+
+	path := setupUserFile(t, damaged)
+	backup_name, err := rewriteUserFile(path, parseDamagedUserData, repairUserData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEditBackup(t, backup_name, damaged)
+	u, err := LoadUserData(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Level != 1 || u.Coins != 0 {
+		t.Fatalf("level = %d, coins = %d", u.Level, u.Coins)
+	}
+	// 固定部分的其余字段保留, 禅境花园和成就被丢弃
+	want, _ := ParseUserData(original)
+	if u.Version != want.Version || u.FinishedAdventure != want.FinishedAdventure || u.ChallengeRecords != want.ChallengeRecords ||
+		u.Purchases != want.Purchases || u.PlayTimeActive != want.PlayTimeActive || u.HasUnlockedSurvivalMode != want.HasUnlockedSurvivalMode {
+		t.Fatalf("fixed fields changed: %+v", u)
+	}
+	if len(u.PottedPlants) != 0 || !reflect.DeepEqual(u.Achievements, make([]bool, userAchievementCount)) || len(u.Tail) != 0 {
+		t.Fatalf("potted plants = %d, achievements = %v, tail = %v", len(u.PottedPlants), u.Achievements, u.Tail)
+	}
+
+	// 完好的存档修复后不变
+	path = setupUserFile(t, original)
+	if _, err := rewriteUserFile(path, parseDamagedUserData, repairUserData); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(path); !bytes.Equal(data, original) {
+		t.Fatal("repair changed an intact user1.dat")
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// 游戏对象数组中每一项的字节数, 最后4字节为对象ID
+const (
+	zombieSize     = 0x15C
+	plantSize      = 0x14C
+	projectileSize = 0x94
+	coinSize       = 0xD8
+	lawnMowerSize  = 0x48
+	gridItemSize   = 0xEC
+)
+
+// 植物和僵尸中表示已消失的字节
+const (
+	plantDeadOffset  = 0x141
+	zombieDeadOffset = 0xEC
+)
+
+// 棋盘(Board)中的字段偏移
+const (
+	boardSize             = 0x57B0
+	boardSceneOffset      = 0x554C // 场景
+	boardLevelOffset      = 0x5550 // 关卡
+	boardSunOffset        = 0x5560 // 阳光
+	boardTotalWavesOffset = 0x5564 // 总波数
+	boardClockOffset      = 0x5568 // 游戏时钟(厘秒)
+	boardWaveOffset       = 0x557C // 当前波数
+)
+
+// @title: BoardState
+// @description: 棋盘状态
+type BoardState struct {
+	// 场景
+	Scene Scene
+	// 关卡
+	Level int32
+	// 阳光
+	Sun int32
+	// 当前波数/总波数
+	Wave       int32
+	TotalWaves int32
+	// 游戏时钟(厘秒)
+	Clock int32
+}
+
+// @title: Plant
+// @description: 植物
+type Plant struct {
+	Type  PlantType
+	Row   int32
+	Col   int32
+	X     int32
+	Y     int32
+	HP    int32
+	MaxHP int32
+	// 是否已消失
+	Dead bool
+	// 是否在睡觉
+	Asleep bool
+}
+
+// @title: Zombie
+// @description: 僵尸
+type Zombie struct {
+	Type   ZombieType
+	Row    int32
+	Status int32
+	X      float32
+	Y      float32
+	// 本体/头盔/盾牌血量
+	HP       int32
+	MaxHP    int32
+	HelmHP   int32
+	ShieldHP int32
+	// 是否已消失
+	Dead bool
+}
+
+// @title: Projectile
+// @description: 子弹
+type Projectile struct {
+	Type int32
+	Row  int32
+	X    float32
+	Y    float32
+	// 是否已消失
+	Dead bool
+}
+
+// @title: Coin
+// @description: 阳光/金币等掉落物
+type Coin struct {
+	Type int32
+	X    float32
+	Y    float32
+	// 是否已被收集
+	Collected bool
+	// 是否已消失
+	Dead bool
+}
+
+func readInt32(b []byte, offset int) int32 {
+	return int32(binary.LittleEndian.Uint32(b[offset:]))
+}
+
+func readFloat32(b []byte, offset int) float32 {
+	return math.Float32frombits(binary.LittleEndian.Uint32(b[offset:]))
+}
+
+// itemAlive 根据数组项末尾的ID判断该项是否在使用中, 空闲项的高16位为0
+func itemAlive(b []byte) bool {
+	return binary.LittleEndian.Uint32(b[len(b)-4:])>>16 != 0
+}
+
+func decodeBoardState(b []byte) BoardState {
+	return BoardState{
+		Scene:      Scene(readInt32(b, boardSceneOffset)),
+		Level:      readInt32(b, boardLevelOffset),
+		Sun:        readInt32(b, boardSunOffset),
+		Wave:       readInt32(b, boardWaveOffset),
+		TotalWaves: readInt32(b, boardTotalWavesOffset),
+		Clock:      readInt32(b, boardClockOffset),
+	}
+}
+
+func decodePlant(b []byte) Plant {
+	return Plant{
+		X:      readInt32(b, 0x08),
+		Y:      readInt32(b, 0x0C),
+		Row:    readInt32(b, 0x1C),
+		Type:   PlantType(readInt32(b, 0x24)),
+		Col:    readInt32(b, 0x28),
+		HP:     readInt32(b, 0x40),
+		MaxHP:  readInt32(b, 0x44),
+		Dead:   b[plantDeadOffset] != 0,
+		Asleep: b[0x143] != 0,
+	}
+}
+
+func decodeZombie(b []byte) Zombie {
+	return Zombie{
+		Row:      readInt32(b, 0x1C),
+		Type:     ZombieType(readInt32(b, 0x24)),
+		Status:   readInt32(b, 0x28),
+		X:        readFloat32(b, 0x2C),
+		Y:        readFloat32(b, 0x30),
+		HP:       readInt32(b, 0xC8),
+		MaxHP:    readInt32(b, 0xCC),
+		HelmHP:   readInt32(b, 0xD0),
+		ShieldHP: readInt32(b, 0xDC),
+		Dead:     b[zombieDeadOffset] != 0,
+	}
+}
+
+func decodeProjectile(b []byte) Projectile {
+	return Projectile{
+		Row:  readInt32(b, 0x1C),
+		X:    readFloat32(b, 0x30),
+		Y:    readFloat32(b, 0x34),
+		Dead: b[0x50] != 0,
+		Type: readInt32(b, 0x5C),
+	}
+}
+
+func decodeCoin(b []byte) Coin {
+	return Coin{
+		X:         readFloat32(b, 0x24),
+		Y:         readFloat32(b, 0x28),
+		Dead:      b[0x38] != 0,
+		Collected: b[0x50] != 0,
+		Type:      readInt32(b, 0x58),
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// 游戏事件
+const (
+	EventGameStarted    = "game_started"    // 游戏启动
+	EventGameExited     = "game_exited"     // 游戏退出
+	EventUIChanged      = "ui_changed"      // 游戏界面变化
+	EventLevelStarted   = "level_started"   // 进入关卡
+	EventLevelCompleted = "level_completed" // 关卡胜利
+	EventLevelFailed    = "level_failed"    // 僵尸吃掉了脑子
+	EventLevelExited    = "level_exited"    // 未分胜负就离开关卡
+	EventWaveStarted    = "wave_started"    // 新的一波僵尸
+	EventMusicChanged   = "music_changed"   // 音乐变化
+	EventBackup         = "backup"          // 备份完成
+	EventBackupFailed   = "backup_failed"   // 备份失败
+	EventRestore        = "restore"         // 恢复完成
+	EventRestoreFailed  = "restore_failed"  // 恢复失败
+)
+
+// @title: GameEvent
+// @description: 游戏事件
+type GameEvent struct {
+	Type string                 `json:"type"`
+	Time time.Time              `json:"time"`
+	Data map[string]interface{} `json:"data,omitempty"`
+}
+
+// @title: NewGameEvent
+// @description: 创建当前时间的游戏事件
+// @param: t string 事件类型
+// @param: data map[string]interface{} 事件数据
+// @return: GameEvent
+func NewGameEvent(t string, data map[string]interface{}) GameEvent {
+	return GameEvent{Type: t, Time: time.Now(), Data: data}
+}
+
+// @title: EventBus
+// @description: 事件总线, 订阅者处理不过来时丢弃事件, 不会阻塞发布者
+type EventBus struct {
+	lock        sync.Mutex
+	subscribers map[chan GameEvent]struct{}
+}
+
+// 游戏事件总线
+var game_events = NewEventBus()
+
+// @title: NewEventBus
+// @description: 创建事件总线
+// @return: *EventBus
+func NewEventBus() *EventBus {
+	return &EventBus{subscribers: map[chan GameEvent]struct{}{}}
+}
+
+// @title: EventBus::Subscribe
+// @description: 订阅事件
+// @param: buffer int 缓冲的事件数量
+// @return: <-chan GameEvent, func() 取消订阅
+func (b *EventBus) Subscribe(buffer int) (<-chan GameEvent, func()) {
+	ch := make(chan GameEvent, buffer)
+	b.lock.Lock()
+	b.subscribers[ch] = struct{}{}
+	b.lock.Unlock()
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.lock.Lock()
+			delete(b.subscribers, ch)
+			b.lock.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// @title: EventBus::Publish
+// @description: 发布事件
+// @param: e GameEvent 事件
+func (b *EventBus) Publish(e GameEvent) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	for ch := range b.subscribers {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// @title: GameState
+// @description: 用于检测游戏事件的状态
+type GameState struct {
+	Running    bool
+	UI         GameUI
+	Music      MusicID
+	GameMode   int32
+	Level      int32
+	Scene      Scene
+	Wave       int32
+	TotalWaves int32
+}
+
+// @title: ReadGameState
+// @description: 从游戏内存读取状态, 不在关卡中时棋盘相关字段为0
+// @param: m Memory 游戏内存
+// @return: GameState, error
+func ReadGameState(m Memory) (GameState, error) {
+	s := GameState{Running: true, UI: GameUIUnavailable}
+	app, err := m.ReadBytes(lawnAppGameUIOffset+4, lawnAppBase, 0)
+	if err != nil {
+		return s, err
+	}
+	s.UI = GameUI(readInt32(app, lawnAppGameUIOffset))
+	s.GameMode = readInt32(app, lawnAppGameModeOffset)
+	if id, err := m.ReadBytes(4, lawnAppBase, lawnAppMusicOffset, musicIDOffset); err == nil {
+		s.Music = MusicID(readInt32(id, 0))
+	}
+	if readInt32(app, lawnAppBoardOffset) != 0 {
+		board, err := ReadBoard(m)
+		if err != nil {
+			return s, err
+		}
+		s.Level, s.Scene, s.Wave, s.TotalWaves = board.Level, board.Scene, board.Wave, board.TotalWaves
+	}
+	return s, nil
+}
+
+// @title: GameWatcher
+// @description: 比较前后两次的状态产生游戏事件
+type GameWatcher struct {
+	last  GameState
+	ready bool
+}
+
+// @title: GameWatcher::Update
+// @description: 记录新的状态, 返回状态变化产生的事件
+// 第一次调用只记录状态, 游戏已经在运行时产生game_started, 这样工具启动前打开的游戏也会被记录
+// @param: s GameState 当前状态
+// @return: []GameEvent
+func (w *GameWatcher) Update(s GameState) []GameEvent {
+	if !s.Running {
+		s.UI = GameUIUnavailable
+	}
+	prev := w.last
+	w.last = s
+	if !w.ready {
+		w.ready = true
+		if s.Running {
+			return []GameEvent{NewGameEvent(EventGameStarted, nil)}
+		}
+		return nil
+	}
+
+	events := []GameEvent{}
+	if s.Running && !prev.Running {
+		events = append(events, NewGameEvent(EventGameStarted, nil))
+	}
+	if s.UI != prev.UI {
+		events = append(events, NewGameEvent(EventUIChanged, map[string]interface{}{
+			"from": prev.UI.String(), "to": s.UI.String(),
+		}))
+		level := map[string]interface{}{
+			"game_mode": prev.GameMode, "level": prev.Level, "scene": int32(prev.Scene), "wave": prev.Wave, "total_waves": prev.TotalWaves,
+		}
+		if prev.UI == GameUIPlaying {
+			switch s.UI {
+			case GameUIAward:
+				events = append(events, NewGameEvent(EventLevelCompleted, level))
+			case GameUIZombiesWon:
+				events = append(events, NewGameEvent(EventLevelFailed, level))
+			default:
+				events = append(events, NewGameEvent(EventLevelExited, level))
+			}
+		}
+		if s.UI == GameUIPlaying {
+			events = append(events, NewGameEvent(EventLevelStarted, map[string]interface{}{
+				"game_mode": s.GameMode, "level": s.Level, "scene": int32(s.Scene), "total_waves": s.TotalWaves,
+			}))
+		}
+	}
+	if s.UI == GameUIPlaying && prev.UI == GameUIPlaying && s.Wave > prev.Wave {
+		events = append(events, NewGameEvent(EventWaveStarted, map[string]interface{}{
+			"game_mode": s.GameMode, "level": s.Level, "wave": s.Wave, "total_waves": s.TotalWaves,
+		}))
+	}
+	if s.Running && prev.Running && s.Music != prev.Music {
+		events = append(events, NewGameEvent(EventMusicChanged, map[string]interface{}{
+			"music": s.Music, "name": s.Music.String(),
+		}))
+	}
+	if !s.Running && prev.Running {
+		events = append(events, NewGameEvent(EventGameExited, nil))
+	}
+	return events
+}
+
+var game_watcher = &GameWatcher{}
+
+// @title: PollGameEvents
+// @description: 读取游戏状态并发布产生的事件, 由监测游戏状态的协程定时调用
+// @param: running bool 游戏是否在运行
+func PollGameEvents(running bool) {
+	s := GameState{UI: GameUIUnavailable}
+	if running && pvz.IsValid() {
+		state, err := ReadGameState(pvz)
+		if err != nil {
+			// 读取失败时等下次再比较
+			return
+		}
+		s = state
+	}
+	for _, e := range game_watcher.Update(s) {
+		game_events.Publish(e)
+	}
+}
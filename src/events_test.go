@@ -0,0 +1,43 @@
+package main
+
+import "testing"
+
+func eventTypes(events []GameEvent) []string {
+	types := []string{}
+	for _, e := range events {
+		types = append(types, e.Type)
+	}
+	return types
+}
+
+func TestGameWatcherStartsRunning(t *testing.T) {
+	w := &GameWatcher{}
+	events := w.Update(GameState{Running: true, UI: GameUIPlaying, Level: 5})
+	if len(events) != 1 || events[0].Type != EventGameStarted {
+		t.Fatalf("第一次更新 = %v, 应为game_started", eventTypes(events))
+	}
+	if events := (&GameWatcher{}).Update(GameState{UI: GameUIUnavailable}); len(events) != 0 {
+		t.Fatalf("游戏未运行时第一次更新 = %v", eventTypes(events))
+	}
+}
+
+func TestGameWatcherLevelEvents(t *testing.T) {
+	w := &GameWatcher{}
+	w.Update(GameState{Running: true, UI: GameUISeedSelect})
+
+	events := w.Update(GameState{Running: true, UI: GameUIPlaying, GameMode: 13, Level: 1, TotalWaves: 20})
+	if got := eventTypes(events); len(got) != 2 || got[1] != EventLevelStarted {
+		t.Fatalf("进入关卡 = %v", got)
+	}
+	if mode, _ := historyInt(events[1], "game_mode"); mode != 13 {
+		t.Errorf("level_started game_mode = %d", mode)
+	}
+
+	events = w.Update(GameState{Running: true, UI: GameUIAward, GameMode: 13, Level: 1})
+	if got := eventTypes(events); len(got) != 2 || got[1] != EventLevelCompleted {
+		t.Fatalf("关卡胜利 = %v", got)
+	}
+	if mode, _ := historyInt(events[1], "game_mode"); mode != 13 {
+		t.Errorf("level_completed game_mode = %d", mode)
+	}
+}
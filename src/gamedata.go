@@ -0,0 +1,259 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// @title: GameUI
+// @description: 游戏界面
+type GameUI int32
+
+const (
+	GameUIUnavailable GameUI = -1 // 游戏未运行
+	GameUILoading     GameUI = 0  // 加载
+	GameUIMainMenu    GameUI = 1  // 主界面
+	GameUISeedSelect  GameUI = 2  // 选卡
+	GameUIPlaying     GameUI = 3  // 正常游戏/战斗
+	GameUIZombiesWon  GameUI = 4  // 僵尸进屋
+	GameUIAward       GameUI = 5  // 奖励
+	GameUICredits     GameUI = 6  // 制作人员
+	GameUIModeSelect  GameUI = 7  // 模式选择
+)
+
+var gameUINames = map[GameUI]string{
+	GameUIUnavailable: "unavailable",
+	GameUILoading:     "loading",
+	GameUIMainMenu:    "main menu",
+	GameUISeedSelect:  "seed select",
+	GameUIPlaying:     "playing",
+	GameUIZombiesWon:  "zombies won",
+	GameUIAward:       "award",
+	GameUICredits:     "credits",
+	GameUIModeSelect:  "mode select",
+}
+
+func (ui GameUI) String() string {
+	if name, ok := gameUINames[ui]; ok {
+		return name
+	}
+	return fmt.Sprintf("ui#%d", int32(ui))
+}
+
+// @title: GameUI::InLevel
+// @description: 是否在关卡中(选卡、战斗、僵尸进屋), 此时不能恢复存档
+// @return: bool
+func (ui GameUI) InLevel() bool {
+	return ui == GameUISeedSelect || ui == GameUIPlaying || ui == GameUIZombiesWon
+}
+
+// @title: Scene
+// @description: 关卡场景
+type Scene int32
+
+const (
+	SceneDay       Scene = 0 // 白天
+	SceneNight     Scene = 1 // 黑夜
+	ScenePool      Scene = 2 // 泳池
+	SceneFog       Scene = 3 // 浓雾
+	SceneRoof      Scene = 4 // 屋顶
+	SceneMoonNight Scene = 5 // 月夜(屋顶)
+)
+
+var sceneNames = map[Scene]string{
+	SceneDay:       "day",
+	SceneNight:     "night",
+	ScenePool:      "pool",
+	SceneFog:       "fog",
+	SceneRoof:      "roof",
+	SceneMoonNight: "moon night",
+}
+
+func (s Scene) String() string {
+	if name, ok := sceneNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("scene#%d", int32(s))
+}
+
+// @title: Scene::Rows
+// @description: 场景的行数, 泳池和浓雾为6行, 其他为5行
+// @return: int
+func (s Scene) Rows() int {
+	if s == ScenePool || s == SceneFog {
+		return 6
+	}
+	return 5
+}
+
+// @title: MusicID
+// @description: 背景音乐
+type MusicID int32
+
+const (
+	MusicGrasswalk      MusicID = 1
+	MusicMoongrains     MusicID = 2
+	MusicWateryGraves   MusicID = 3
+	MusicRigorMormist   MusicID = 4
+	MusicGrazeTheRoof   MusicID = 5
+	MusicChooseYourSeed MusicID = 6
+	MusicCrazyDave      MusicID = 7
+	MusicZenGarden      MusicID = 8
+	MusicCerebrawl      MusicID = 9
+	MusicLoonboon       MusicID = 10
+	MusicUltimateBattle MusicID = 11
+	MusicBrainiacManiac MusicID = 12
+)
+
+func (id MusicID) String() string {
+	if id == MusicNone {
+		return "none"
+	}
+	return version_profile.name(version_profile.Music, int32(id), "music")
+}
+
+// @title: PlantType
+// @description: 植物类型
+type PlantType int32
+
+func (t PlantType) String() string {
+	return version_profile.name(version_profile.Plants, int32(t), "plant")
+}
+
+// @title: ZombieType
+// @description: 僵尸类型
+type ZombieType int32
+
+func (t ZombieType) String() string {
+	return version_profile.name(version_profile.Zombies, int32(t), "zombie")
+}
+
+// @title: VersionProfile
+// @description: 游戏版本的名称表, 杂交版新增的植物和僵尸可以在配置文件中补充
+type VersionProfile struct {
+	Name    string           `json:"name"`
+	Plants  map[int32]string `json:"plants"`
+	Zombies map[int32]string `json:"zombies"`
+	Music   map[int32]string `json:"music"`
+}
+
+// 当前使用的版本
+var version_profile = DefaultVersionProfile()
+
+// name 查找名称, 找不到时为 kind#id
+func (v *VersionProfile) name(names map[int32]string, id int32, kind string) string {
+	if name, ok := names[id]; ok {
+		return name
+	}
+	return fmt.Sprintf("%s#%d", kind, id)
+}
+
+// @title: DefaultVersionProfile
+// @description: 内置的版本, 包含原版的植物、僵尸和音乐
+// 杂交版每次更新都会增加和调整植物、僵尸, 且没有公开的ID表, 因此不内置杂交版的名称,
+// 名称表中没有的ID显示为 plant#ID / zombie#ID, 在版本配置文件中补充后才能用于种植和生成僵尸
+// @return: *VersionProfile
+func DefaultVersionProfile() *VersionProfile {
+	v := &VersionProfile{Name: "pvz 1.0.0.1051", Plants: map[int32]string{}, Zombies: map[int32]string{}, Music: map[int32]string{}}
+	for i, name := range []string{
+		"Peashooter", "Sunflower", "Cherry Bomb", "Wall-nut", "Potato Mine", "Snow Pea", "Chomper", "Repeater",
+		"Puff-shroom", "Sun-shroom", "Fume-shroom", "Grave Buster", "Hypno-shroom", "Scaredy-shroom", "Ice-shroom", "Doom-shroom",
+		"Lily Pad", "Squash", "Threepeater", "Tangle Kelp", "Jalapeno", "Spikeweed", "Torchwood", "Tall-nut",
+		"Sea-shroom", "Plantern", "Cactus", "Blover", "Split Pea", "Starfruit", "Pumpkin", "Magnet-shroom",
+		"Cabbage-pult", "Flower Pot", "Kernel-pult", "Coffee Bean", "Garlic", "Umbrella Leaf", "Marigold", "Melon-pult",
+		"Gatling Pea", "Twin Sunflower", "Gloom-shroom", "Cattail", "Winter Melon", "Gold Magnet", "Spikerock", "Cob Cannon",
+		"Imitater",
+	} {
+		v.Plants[int32(i)] = name
+	}
+	for i, name := range []string{
+		"Zombie", "Flag Zombie", "Conehead Zombie", "Pole Vaulting Zombie", "Buckethead Zombie", "Newspaper Zombie",
+		"Screen Door Zombie", "Football Zombie", "Dancing Zombie", "Backup Dancer", "Ducky Tube Zombie", "Snorkel Zombie",
+		"Zomboni", "Zombie Bobsled Team", "Dolphin Rider Zombie", "Jack-in-the-Box Zombie", "Balloon Zombie", "Digger Zombie",
+		"Pogo Zombie", "Zombie Yeti", "Bungee Zombie", "Ladder Zombie", "Catapult Zombie", "Gargantuar",
+		"Imp", "Dr. Zomboss", "Peashooter Zombie", "Wall-nut Zombie", "Jalapeno Zombie", "Gatling Pea Zombie",
+		"Squash Zombie", "Tall-nut Zombie", "GigaGargantuar",
+	} {
+		v.Zombies[int32(i)] = name
+	}
+	for id, name := range map[MusicID]string{
+		MusicGrasswalk: "Grasswalk", MusicMoongrains: "Moongrains", MusicWateryGraves: "Watery Graves",
+		MusicRigorMormist: "Rigor Mormist", MusicGrazeTheRoof: "Graze the Roof", MusicChooseYourSeed: "Choose Your Seeds",
+		MusicCrazyDave: "Crazy Dave", MusicZenGarden: "Zen Garden", MusicCerebrawl: "Cerebrawl",
+		MusicLoonboon: "Loonboon", MusicUltimateBattle: "Ultimate Battle", MusicBrainiacManiac: "Brainiac Maniac",
+	} {
+		v.Music[int32(id)] = name
+	}
+	return v
+}
+
+// @title: LoadVersionProfile
+// @description: 读取版本配置文件, 文件中的名称覆盖或补充内置的名称
+// @param: path string 文件路径
+// @return: *VersionProfile, error
+func LoadVersionProfile(path string) (*VersionProfile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	loaded := &VersionProfile{}
+	if err := json.Unmarshal(data, loaded); err != nil {
+		return nil, fmt.Errorf("版本配置格式错误: %v", err)
+	}
+	v := DefaultVersionProfile()
+	if loaded.Name != "" {
+		v.Name = loaded.Name
+	}
+	for id, name := range loaded.Plants {
+		v.Plants[id] = name
+	}
+	for id, name := range loaded.Zombies {
+		v.Zombies[id] = name
+	}
+	for id, name := range loaded.Music {
+		v.Music[id] = name
+	}
+	return v, nil
+}
+
+// @title: ParsePlantType
+// @description: 按ID、名称(不区分大小写)或 plant#ID 查找植物, ID可以不在名称表中
+// @param: s string
+// @return: PlantType, error
+func ParsePlantType(s string) (PlantType, error) {
+	id, err := version_profile.lookup(version_profile.Plants, s, "plant")
+	if err != nil {
+		return 0, fmt.Errorf("未知的植物 %s", s)
+	}
+	return PlantType(id), nil
+}
+
+// @title: ParseZombieType
+// @description: 按ID、名称(不区分大小写)或 zombie#ID 查找僵尸, ID可以不在名称表中
+// @param: s string
+// @return: ZombieType, error
+func ParseZombieType(s string) (ZombieType, error) {
+	id, err := version_profile.lookup(version_profile.Zombies, s, "zombie")
+	if err != nil {
+		return 0, fmt.Errorf("未知的僵尸 %s", s)
+	}
+	return ZombieType(id), nil
+}
+
+// lookup 按ID或名称查找, 也接受name找不到名称时输出的 kind#id
+// 名称表可能不全, ID不要求在名称表中, 是否可用由调用者检查
+func (v *VersionProfile) lookup(names map[int32]string, s string, kind string) (int32, error) {
+	if id, err := strconv.ParseInt(strings.TrimPrefix(s, kind+"#"), 10, 32); err == nil && id >= 0 {
+		return int32(id), nil
+	}
+	for id, name := range names {
+		if strings.EqualFold(name, s) {
+			return id, nil
+		}
+	}
+	return 0, errors.New("not found")
+}
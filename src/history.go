@@ -0,0 +1,448 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// 记录到历史中的事件
+var historyEvents = map[string]bool{
+	EventGameStarted:    true,
+	EventGameExited:     true,
+	EventLevelStarted:   true,
+	EventLevelCompleted: true,
+	EventLevelFailed:    true,
+	EventLevelExited:    true,
+	EventBackup:         true,
+	EventRestore:        true,
+}
+
+// @title: HistoryPath
+// @description: 历史记录文件路径, 与配置文件在同一目录
+// @return: string
+func HistoryPath() string {
+	return filepath.Join(filepath.Dir(ConfigPath()), "history.jsonl")
+}
+
+// @title: HistoryRecorder
+// @description: 将游戏事件按行追加到历史记录文件, 关卡结束时记录所用时间
+type HistoryRecorder struct {
+	lock        sync.Mutex
+	path        string
+	level_start time.Time
+	// 记录后的回调
+	on_record func(GameEvent)
+}
+
+// @title: NewHistoryRecorder
+// @description: 创建历史记录
+// @param: path string 文件路径
+// @return: *HistoryRecorder
+func NewHistoryRecorder(path string) *HistoryRecorder {
+	return &HistoryRecorder{path: path}
+}
+
+// @title: HistoryRecorder::Record
+// @description: 记录事件, 不需要记录的事件会被忽略
+// @param: e GameEvent 事件
+// @return: error
+func (h *HistoryRecorder) Record(e GameEvent) error {
+	if !historyEvents[e.Type] {
+		return nil
+	}
+	h.lock.Lock()
+	switch e.Type {
+	case EventLevelStarted:
+		h.level_start = e.Time
+	case EventLevelCompleted, EventLevelFailed, EventLevelExited:
+		// 工具在关卡中启动时没有开始时间
+		if !h.level_start.IsZero() {
+			data := map[string]interface{}{}
+			for k, v := range e.Data {
+				data[k] = v
+			}
+			data["seconds"] = int64(e.Time.Sub(h.level_start) / time.Second)
+			e.Data = data
+		}
+		h.level_start = time.Time{}
+	case EventGameExited:
+		h.level_start = time.Time{}
+	}
+	err := appendHistory(h.path, e)
+	on_record := h.on_record
+	h.lock.Unlock()
+	if err == nil && on_record != nil {
+		on_record(e)
+	}
+	return err
+}
+
+// @title: HistoryRecorder::OnRecord
+// @description: 设置记录后的回调
+// @param: f func(GameEvent) 回调
+func (h *HistoryRecorder) OnRecord(f func(GameEvent)) {
+	h.lock.Lock()
+	h.on_record = f
+	h.lock.Unlock()
+}
+
+// @title: HistoryRecorder::Run
+// @description: 订阅游戏事件并记录, 返回停止函数
+// @param: bus *EventBus 事件总线
+// @return: func() 停止
+func (h *HistoryRecorder) Run(bus *EventBus) func() {
+	events, unsubscribe := bus.Subscribe(64)
+	go func() {
+		for e := range events {
+			if err := h.Record(e); err != nil {
+				log.Println("记录历史失败:", err)
+			}
+		}
+	}()
+	return unsubscribe
+}
+
+// appendHistory 在文件末尾追加一行
+func appendHistory(path string, e GameEvent) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if err := MakeDir(filepath.Dir(path)); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0666)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+// @title: ReadHistory
+// @description: 读取历史记录, 跳过无法解析的行
+// @param: path string 文件路径
+// @return: []GameEvent, error 文件不存在时返回空记录
+func ReadHistory(path string) ([]GameEvent, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return []GameEvent{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseHistory(f)
+}
+
+func parseHistory(r io.Reader) ([]GameEvent, error) {
+	events := []GameEvent{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		var e GameEvent
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil || e.Type == "" {
+			// 写入时程序退出可能留下不完整的行
+			continue
+		}
+		events = append(events, e)
+	}
+	return events, scanner.Err()
+}
+
+// historyInt 读取事件数据中的整数, JSON中的数字解析为float64
+func historyInt(e GameEvent, key string) (int64, bool) {
+	switch v := e.Data[key].(type) {
+	case float64:
+		return int64(v), true
+	case int64:
+		return v, true
+	case int32:
+		return int64(v), true
+	case int:
+		return int64(v), true
+	}
+	return 0, false
+}
+
+func historyString(e GameEvent, key string) string {
+	if s, ok := e.Data[key].(string); ok {
+		return s
+	}
+	return ""
+}
+
+// @title: LevelStats
+// @description: 单个关卡的统计, 不同游戏模式的同一关分开统计
+type LevelStats struct {
+	GameMode  int32 `json:"game_mode"`
+	Level     int32 `json:"level"`
+	Started   int   `json:"started"`
+	Completed int   `json:"completed"`
+	Failed    int   `json:"failed"`
+	Exited    int   `json:"exited"`
+	// 有开始时间的关卡的总用时和最快通关用时(秒)
+	TotalSeconds int64 `json:"total_seconds"`
+	BestSeconds  int64 `json:"best_seconds,omitempty"`
+}
+
+// @title: HistoryStats
+// @description: 历史记录的统计
+type HistoryStats struct {
+	Sessions     int   `json:"sessions"`
+	PlaySeconds  int64 `json:"play_seconds"`
+	Started      int   `json:"started"`
+	Completed    int   `json:"completed"`
+	Failed       int   `json:"failed"`
+	Exited       int   `json:"exited"`
+	LevelSeconds int64 `json:"level_seconds"`
+	// 僵尸吃掉脑子的次数, 即界面变为 zombies won 的次数
+	ZombiesWon int            `json:"zombies_won"`
+	Backups    int            `json:"backups"`
+	Restores   int            `json:"restores"`
+	Triggers   map[string]int `json:"triggers"`
+	Levels     []*LevelStats  `json:"levels"`
+	levels     map[levelKey]*LevelStats
+}
+
+// levelKey 按游戏模式和关卡统计
+type levelKey struct {
+	mode  int32
+	level int32
+}
+
+// @title: ComputeStats
+// @description: 统计历史记录
+// @param: events []GameEvent 历史记录
+// @return: *HistoryStats
+func ComputeStats(events []GameEvent) *HistoryStats {
+	s := &HistoryStats{Triggers: map[string]int{}, Levels: []*LevelStats{}, levels: map[levelKey]*LevelStats{}}
+	level := func(e GameEvent) *LevelStats {
+		// 旧的记录没有游戏模式, 视为冒险模式(0)
+		mode, _ := historyInt(e, "game_mode")
+		id, _ := historyInt(e, "level")
+		key := levelKey{int32(mode), int32(id)}
+		l, ok := s.levels[key]
+		if !ok {
+			l = &LevelStats{GameMode: key.mode, Level: key.level}
+			s.levels[key] = l
+			s.Levels = append(s.Levels, l)
+		}
+		return l
+	}
+	// last为上一条记录的时间
+	var session_start, last time.Time
+	for _, e := range events {
+		switch e.Type {
+		case EventGameStarted:
+			// 工具退出时没有记录game_exited, 上一次游戏在最后一条记录处结束
+			if !session_start.IsZero() {
+				s.PlaySeconds += int64(last.Sub(session_start) / time.Second)
+			}
+			s.Sessions++
+			session_start = e.Time
+		case EventGameExited:
+			if !session_start.IsZero() {
+				s.PlaySeconds += int64(e.Time.Sub(session_start) / time.Second)
+				session_start = time.Time{}
+			}
+		case EventLevelStarted:
+			s.Started++
+			level(e).Started++
+		case EventLevelCompleted, EventLevelFailed, EventLevelExited:
+			l := level(e)
+			seconds, timed := historyInt(e, "seconds")
+			switch e.Type {
+			case EventLevelCompleted:
+				s.Completed++
+				l.Completed++
+				if timed && (l.BestSeconds == 0 || seconds < l.BestSeconds) {
+					l.BestSeconds = seconds
+				}
+			case EventLevelFailed:
+				s.Failed++
+				s.ZombiesWon++
+				l.Failed++
+			default:
+				s.Exited++
+				l.Exited++
+			}
+			if timed {
+				s.LevelSeconds += seconds
+				l.TotalSeconds += seconds
+			}
+		case EventBackup:
+			s.Backups++
+			s.Triggers[historyString(e, "trigger")]++
+		case EventRestore:
+			s.Restores++
+		}
+		last = e.Time
+	}
+	sort.Slice(s.Levels, func(i, j int) bool {
+		if s.Levels[i].GameMode != s.Levels[j].GameMode {
+			return s.Levels[i].GameMode < s.Levels[j].GameMode
+		}
+		return s.Levels[i].Level < s.Levels[j].Level
+	})
+	return s
+}
+
+// @title: HistoryStats::Summary
+// @description: 统计的文字描述
+// @return: []string 每项一行
+func (s *HistoryStats) Summary() []string {
+	lines := []string{
+		fmt.Sprintf("sessions: %d, play time: %s", s.Sessions, time.Duration(s.PlaySeconds)*time.Second),
+		fmt.Sprintf("levels: %d started, %d completed, %d failed, %d exited, %s in levels",
+			s.Started, s.Completed, s.Failed, s.Exited, time.Duration(s.LevelSeconds)*time.Second),
+		fmt.Sprintf("zombies won: %d", s.ZombiesWon),
+		fmt.Sprintf("backups: %d, restores: %d", s.Backups, s.Restores),
+	}
+	triggers := []string{}
+	for trigger, n := range s.Triggers {
+		triggers = append(triggers, fmt.Sprintf("%s %d", trigger, n))
+	}
+	if len(triggers) > 0 {
+		sort.Strings(triggers)
+		lines = append(lines, "backup triggers: "+strings.Join(triggers, ", "))
+	}
+	return lines
+}
+
+// @title: ExportHistoryCSV
+// @description: 将历史记录导出为CSV, 每个事件一行
+// @param: w io.Writer
+// @param: events []GameEvent 历史记录
+// @return: error
+func ExportHistoryCSV(w io.Writer, events []GameEvent) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"time", "event", "game_mode", "level", "scene", "wave", "total_waves", "seconds", "name", "trigger"})
+	for _, e := range events {
+		row := []string{e.Time.Format(time.RFC3339), e.Type}
+		for _, key := range []string{"game_mode", "level", "scene", "wave", "total_waves", "seconds"} {
+			if v, ok := historyInt(e, key); ok {
+				row = append(row, strconv.FormatInt(v, 10))
+			} else {
+				row = append(row, "")
+			}
+		}
+		row = append(row, historyString(e, "name"), historyString(e, "trigger"))
+		cw.Write(row)
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// @title: ExportLevelStatsCSV
+// @description: 将每个关卡的统计导出为CSV
+// @param: w io.Writer
+// @param: s *HistoryStats 统计
+// @return: error
+func ExportLevelStatsCSV(w io.Writer, s *HistoryStats) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"game_mode", "level", "started", "completed", "failed", "exited", "total_seconds", "best_seconds"})
+	for _, l := range s.Levels {
+		cw.Write([]string{
+			strconv.Itoa(int(l.GameMode)), strconv.Itoa(int(l.Level)), strconv.Itoa(l.Started), strconv.Itoa(l.Completed),
+			strconv.Itoa(l.Failed), strconv.Itoa(l.Exited),
+			strconv.FormatInt(l.TotalSeconds, 10), strconv.FormatInt(l.BestSeconds, 10),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// @title: NewStatsTab
+// @description: 统计页
+// @param: w fyne.Window 父窗口
+// @return: fyne.CanvasObject, func() 历史记录变化时刷新
+func NewStatsTab(w fyne.Window) (fyne.CanvasObject, func()) {
+	summary_label := widget.NewLabel("")
+	summary_label.Wrapping = fyne.TextWrapWord
+	stats := ComputeStats(nil)
+	headers := []string{"mode", "level", "started", "won", "lost", "exited", "time", "best"}
+	table := widget.NewTable(func() (int, int) {
+		return len(stats.Levels) + 1, len(headers)
+	}, func() fyne.CanvasObject {
+		return widget.NewLabel("0000000000")
+	}, func(id widget.TableCellID, o fyne.CanvasObject) {
+		label := o.(*widget.Label)
+		if id.Row == 0 {
+			label.SetText(headers[id.Col])
+			return
+		}
+		l := stats.Levels[id.Row-1]
+		values := []string{
+			strconv.Itoa(int(l.GameMode)), strconv.Itoa(int(l.Level)), strconv.Itoa(l.Started), strconv.Itoa(l.Completed),
+			strconv.Itoa(l.Failed), strconv.Itoa(l.Exited),
+			(time.Duration(l.TotalSeconds) * time.Second).String(), "",
+		}
+		if l.BestSeconds > 0 {
+			values[7] = (time.Duration(l.BestSeconds) * time.Second).String()
+		}
+		label.SetText(values[id.Col])
+	})
+
+	refresh := func() {
+		events, err := ReadHistory(HistoryPath())
+		if err != nil {
+			summary_label.SetText(err.Error())
+			return
+		}
+		stats = ComputeStats(events)
+		summary_label.SetText(strings.Join(stats.Summary(), "\n"))
+		table.Refresh()
+	}
+	refresh()
+
+	export := func(name string, write func(io.Writer) error) {
+		d := dialog.NewFileSave(func(wc fyne.URIWriteCloser, err error) {
+			if err != nil || wc == nil {
+				return
+			}
+			err = write(wc)
+			if close_err := wc.Close(); err == nil {
+				err = close_err
+			}
+			if err != nil {
+				dialog.NewInformation("Error", err.Error(), w).Show()
+			}
+		}, w)
+		d.SetFileName(name)
+		d.Show()
+	}
+	export_button := widget.NewButton("export history", func() {
+		events, err := ReadHistory(HistoryPath())
+		if err != nil {
+			dialog.NewInformation("Error", err.Error(), w).Show()
+			return
+		}
+		export("history.csv", func(wc io.Writer) error { return ExportHistoryCSV(wc, events) })
+	})
+	export_levels_button := widget.NewButton("export levels", func() {
+		export("levels.csv", func(wc io.Writer) error { return ExportLevelStatsCSV(wc, stats) })
+	})
+
+	return container.NewBorder(
+		container.NewVBox(summary_label, container.NewGridWithColumns(3, widget.NewButton("refresh", refresh), export_button, export_levels_button)),
+		nil, nil, nil,
+		table,
+	), refresh
+}
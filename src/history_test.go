@@ -0,0 +1,58 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestComputeStatsByGameMode(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	event := func(typ string, seconds int, data map[string]interface{}) GameEvent {
+		e := NewGameEvent(typ, data)
+		e.Time = start.Add(time.Duration(seconds) * time.Second)
+		return e
+	}
+	events := []GameEvent{
+		event(EventGameStarted, 0, nil),
+		event(EventLevelStarted, 10, map[string]interface{}{"game_mode": 13, "level": 1}),
+		event(EventLevelCompleted, 70, map[string]interface{}{"game_mode": 13, "level": 1, "seconds": 60}),
+		// 旧的记录没有game_mode
+		event(EventLevelStarted, 80, map[string]interface{}{"level": 1}),
+		event(EventLevelFailed, 100, map[string]interface{}{"level": 1, "seconds": 20}),
+		event(EventGameExited, 120, nil),
+	}
+	s := ComputeStats(events)
+	if s.Sessions != 1 || s.PlaySeconds != 120 {
+		t.Errorf("Sessions = %d, PlaySeconds = %d", s.Sessions, s.PlaySeconds)
+	}
+	if len(s.Levels) != 2 {
+		t.Fatalf("Levels = %d, 同一关的不同模式应分开统计", len(s.Levels))
+	}
+	adventure, survival := s.Levels[0], s.Levels[1]
+	if adventure.GameMode != 0 || adventure.Level != 1 || adventure.Failed != 1 || adventure.Completed != 0 {
+		t.Errorf("冒险模式 = %+v", *adventure)
+	}
+	if survival.GameMode != 13 || survival.Level != 1 || survival.Completed != 1 || survival.BestSeconds != 60 {
+		t.Errorf("模式13 = %+v", *survival)
+	}
+}
+
+func TestComputeStatsUnfinishedSession(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	event := func(typ string, seconds int) GameEvent {
+		e := NewGameEvent(typ, map[string]interface{}{"level": 1})
+		e.Time = start.Add(time.Duration(seconds) * time.Second)
+		return e
+	}
+	// 工具在游戏运行时退出, 重新启动后再次记录game_started
+	events := []GameEvent{
+		event(EventGameStarted, 0),
+		event(EventLevelStarted, 30),
+		event(EventGameStarted, 600),
+		event(EventGameExited, 660),
+	}
+	s := ComputeStats(events)
+	if s.Sessions != 2 || s.PlaySeconds != 30+60 {
+		t.Fatalf("Sessions = %d, PlaySeconds = %d", s.Sessions, s.PlaySeconds)
+	}
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 热键动作
+const (
+	HotkeyBackup        = "backup"         // 立即备份
+	HotkeyRestoreLatest = "restore_latest" // 回到菜单后恢复最新的备份
+)
+
+// 等待回到菜单再恢复的最长时间
+const restoreWaitTimeout = 10 * time.Minute
+
+// @title: Hotkey
+// @description: 热键, 由修饰键和虚拟键码组成
+type Hotkey struct {
+	Modifiers uint32
+	Key       uint32
+}
+
+// 可以使用的按键名, 值为虚拟键码
+var hotkeyKeys = map[string]uint32{
+	"SPACE": 0x20, "PAGEUP": 0x21, "PAGEDOWN": 0x22, "END": 0x23, "HOME": 0x24,
+	"INSERT": 0x2D, "DELETE": 0x2E, "PAUSE": 0x13,
+}
+
+func init() {
+	for i := uint32(1); i <= 24; i++ {
+		hotkeyKeys[fmt.Sprintf("F%d", i)] = 0x70 + i - 1
+	}
+	for c := '0'; c <= '9'; c++ {
+		hotkeyKeys[string(c)] = uint32(c)
+	}
+	for c := 'A'; c <= 'Z'; c++ {
+		hotkeyKeys[string(c)] = uint32(c)
+	}
+}
+
+// @title: ParseHotkey
+// @description: 解析热键, 例如 F5、Ctrl+Shift+S
+// @param: s string
+// @return: Hotkey, error
+func ParseHotkey(s string) (Hotkey, error) {
+	hotkey := Hotkey{}
+	parts := strings.Split(strings.ToUpper(strings.ReplaceAll(s, " ", "")), "+")
+	for i, part := range parts {
+		if i < len(parts)-1 {
+			switch part {
+			case "CTRL", "CONTROL":
+				hotkey.Modifiers |= MOD_CONTROL
+			case "ALT":
+				hotkey.Modifiers |= MOD_ALT
+			case "SHIFT":
+				hotkey.Modifiers |= MOD_SHIFT
+			default:
+				return hotkey, fmt.Errorf("热键 %s 的修饰键 %s 不支持", s, part)
+			}
+			continue
+		}
+		key, ok := hotkeyKeys[part]
+		if !ok {
+			return hotkey, fmt.Errorf("热键 %s 的按键 %s 不支持", s, part)
+		}
+		hotkey.Key = key
+	}
+	return hotkey, nil
+}
+
+// @title: HotkeyBackend
+// @description: 注册全局热键的后端, 按下热键时从Events发送注册时的id
+type HotkeyBackend interface {
+	Register(id int, hotkey Hotkey) error
+	Unregister(id int) error
+	Events() <-chan int
+}
+
+// @title: HotkeyManager
+// @description: 将热键绑定到动作
+type HotkeyManager struct {
+	lock     sync.Mutex
+	backend  HotkeyBackend
+	actions  map[string]func()
+	bindings map[int]string
+}
+
+// @title: NewHotkeyManager
+// @description: 创建热键管理器并开始分发按键
+// @param: backend HotkeyBackend 后端
+// @param: actions map[string]func() 动作名到动作
+// @return: *HotkeyManager
+func NewHotkeyManager(backend HotkeyBackend, actions map[string]func()) *HotkeyManager {
+	m := &HotkeyManager{backend: backend, actions: actions, bindings: map[int]string{}}
+	go func() {
+		for id := range backend.Events() {
+			m.lock.Lock()
+			action, ok := m.actions[m.bindings[id]]
+			m.lock.Unlock()
+			if ok {
+				go action()
+			}
+		}
+	}()
+	return m
+}
+
+// @title: HotkeyManager::Apply
+// @description: 按配置重新注册热键, 空字符串表示不使用
+// @param: hotkeys map[string]string 动作名到热键
+// @return: error 注册失败的热键, 其他热键仍然生效
+func (m *HotkeyManager) Apply(hotkeys map[string]string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for id := range m.bindings {
+		m.backend.Unregister(id)
+	}
+	m.bindings = map[int]string{}
+
+	errs := []string{}
+	id := 1
+	for action, spec := range hotkeys {
+		if spec == "" {
+			continue
+		}
+		if _, ok := m.actions[action]; !ok {
+			errs = append(errs, fmt.Sprintf("未知的热键动作 %s", action))
+			continue
+		}
+		hotkey, err := ParseHotkey(spec)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		if err := m.backend.Register(id, hotkey); err != nil {
+			errs = append(errs, fmt.Sprintf("注册热键 %s 失败: %v", spec, err))
+			continue
+		}
+		m.bindings[id] = action
+		id++
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "\n"))
+	}
+	return nil
+}
+
+// @title: SameHotkeys
+// @description: 比较两份热键配置, 未设置和空字符串相同
+// @param: a map[string]string
+// @param: b map[string]string
+// @return: bool
+func SameHotkeys(a, b map[string]string) bool {
+	for action, spec := range a {
+		if b[action] != spec {
+			return false
+		}
+	}
+	for action, spec := range b {
+		if a[action] != spec {
+			return false
+		}
+	}
+	return true
+}
+
+// @title: HotkeyActions
+// @description: 热键可以触发的动作
+// @return: map[string]func()
+func HotkeyActions() map[string]func() {
+	return map[string]func(){
+		HotkeyBackup: func() {
+			if _, err := ManualBackup("", "", []string{"hotkey"}); err != nil {
+				log.Println(err)
+			}
+		},
+		HotkeyRestoreLatest: func() {
+			// 在关卡中时等回到菜单再恢复
+			deadline := time.Now().Add(restoreWaitTimeout)
+			for !CanRestore() {
+				if time.Now().After(deadline) {
+					Notify(NotifyRestore, "Restore cancelled", "did not return to the menu in time")
+					return
+				}
+				time.Sleep(500 * time.Millisecond)
+			}
+			if _, err := RestoreLatest(); err != nil {
+				log.Println(err)
+			}
+		},
+	}
+}
+
+// winHotkeyBackend 使用RegisterHotKey注册全局热键
+// 热键消息只会发送到注册的线程, 因此注册和接收都在同一个锁定的线程中进行
+type winHotkeyBackend struct {
+	requests chan func()
+	events   chan int
+}
+
+// @title: NewWinHotkeyBackend
+// @description: 创建Windows全局热键后端
+// @return: HotkeyBackend
+func NewWinHotkeyBackend() HotkeyBackend {
+	b := &winHotkeyBackend{requests: make(chan func()), events: make(chan int, 16)}
+	go b.loop()
+	return b
+}
+
+func (b *winHotkeyBackend) loop() {
+	runtime.LockOSThread()
+	var msg MSG
+	for {
+		select {
+		case request := <-b.requests:
+			request()
+		default:
+		}
+		for PeekMessage(&msg, 0, WM_HOTKEY, WM_HOTKEY, PM_REMOVE) != 0 {
+			select {
+			case b.events <- int(msg.WParam):
+			default:
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// call 在热键线程中执行
+func (b *winHotkeyBackend) call(f func() error) error {
+	result := make(chan error, 1)
+	b.requests <- func() { result <- f() }
+	return <-result
+}
+
+func (b *winHotkeyBackend) Register(id int, hotkey Hotkey) error {
+	return b.call(func() error {
+		return RegisterHotKey(0, id, UINT(hotkey.Modifiers|MOD_NOREPEAT), UINT(hotkey.Key))
+	})
+}
+
+func (b *winHotkeyBackend) Unregister(id int) error {
+	return b.call(func() error {
+		return UnregisterHotKey(0, id)
+	})
+}
+
+func (b *winHotkeyBackend) Events() <-chan int {
+	return b.events
+}
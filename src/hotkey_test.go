@@ -0,0 +1,146 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeHotkeyBackend 记录注册的热键, 由测试发送按键
+type fakeHotkeyBackend struct {
+	lock       sync.Mutex
+	registered map[int]Hotkey
+	// 注册这个热键时失败, 模拟被其他程序占用
+	taken  Hotkey
+	events chan int
+}
+
+func newFakeHotkeyBackend() *fakeHotkeyBackend {
+	return &fakeHotkeyBackend{registered: map[int]Hotkey{}, events: make(chan int)}
+}
+
+func (b *fakeHotkeyBackend) Register(id int, hotkey Hotkey) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if hotkey == b.taken {
+		return errors.New("热键已被占用")
+	}
+	b.registered[id] = hotkey
+	return nil
+}
+
+func (b *fakeHotkeyBackend) Unregister(id int) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	delete(b.registered, id)
+	return nil
+}
+
+func (b *fakeHotkeyBackend) Events() <-chan int {
+	return b.events
+}
+
+// hotkeys 当前注册的热键
+func (b *fakeHotkeyBackend) hotkeys() map[Hotkey]int {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	hotkeys := map[Hotkey]int{}
+	for id, hotkey := range b.registered {
+		hotkeys[hotkey] = id
+	}
+	return hotkeys
+}
+
+func TestParseHotkey(t *testing.T) {
+	for s, want := range map[string]Hotkey{
+		"F5":               {Key: 0x74},
+		"ctrl+shift+s":     {Modifiers: MOD_CONTROL | MOD_SHIFT, Key: 'S'},
+		"Alt + PageDown":   {Modifiers: MOD_ALT, Key: 0x22},
+		"Control+9":        {Modifiers: MOD_CONTROL, Key: '9'},
+		"Ctrl+Alt+F24":     {Modifiers: MOD_CONTROL | MOD_ALT, Key: 0x87},
+		"shift+ctrl+space": {Modifiers: MOD_SHIFT | MOD_CONTROL, Key: 0x20},
+	} {
+		if got, err := ParseHotkey(s); err != nil || got != want {
+			t.Errorf("ParseHotkey(%q) = %+v, %v, want %+v", s, got, err, want)
+		}
+	}
+	for _, s := range []string{"", "Ctrl+", "Win+S", "F25", "Ctrl+Shift", "S+Ctrl"} {
+		if _, err := ParseHotkey(s); err == nil {
+			t.Errorf("ParseHotkey(%q) succeeded", s)
+		}
+	}
+}
+
+func TestHotkeyManager(t *testing.T) {
+	backend := newFakeHotkeyBackend()
+	backend.taken = Hotkey{Key: 0x7B} // F12
+	pressed := make(chan string, 4)
+	m := NewHotkeyManager(backend, map[string]func(){
+		HotkeyBackup:        func() { pressed <- HotkeyBackup },
+		HotkeyRestoreLatest: func() { pressed <- HotkeyRestoreLatest },
+	})
+
+	err := m.Apply(map[string]string{HotkeyBackup: "Ctrl+F5", HotkeyRestoreLatest: "F12", "launch": "F6", "unused": ""})
+	if err == nil || !strings.Contains(err.Error(), "F12") || !strings.Contains(err.Error(), "launch") {
+		t.Fatalf("Apply error = %v", err)
+	}
+	// 其他热键仍然生效
+	hotkeys := backend.hotkeys()
+	backup_id, ok := hotkeys[Hotkey{Modifiers: MOD_CONTROL, Key: 0x74}]
+	if len(hotkeys) != 1 || !ok {
+		t.Fatalf("registered = %v", hotkeys)
+	}
+
+	backend.events <- backup_id
+	backend.events <- backup_id + 100 // 没有绑定的id
+	select {
+	case action := <-pressed:
+		if action != HotkeyBackup {
+			t.Fatalf("pressed = %s", action)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("hotkey was not dispatched")
+	}
+
+	// 重新应用时注销旧的热键
+	backend.taken = Hotkey{}
+	if err := m.Apply(map[string]string{HotkeyRestoreLatest: "F12"}); err != nil {
+		t.Fatal(err)
+	}
+	hotkeys = backend.hotkeys()
+	restore_id, ok := hotkeys[Hotkey{Key: 0x7B}]
+	if len(hotkeys) != 1 || !ok {
+		t.Fatalf("registered = %v", hotkeys)
+	}
+	backend.events <- restore_id
+	select {
+	case action := <-pressed:
+		if action != HotkeyRestoreLatest {
+			t.Fatalf("pressed = %s", action)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("hotkey was not dispatched")
+	}
+	select {
+	case action := <-pressed:
+		t.Fatalf("unexpected action %s", action)
+	default:
+	}
+}
+
+func TestSameHotkeys(t *testing.T) {
+	if !SameHotkeys(nil, map[string]string{HotkeyBackup: ""}) {
+		t.Error("nil and empty bindings differ")
+	}
+	if !SameHotkeys(map[string]string{HotkeyBackup: "F5"}, map[string]string{HotkeyBackup: "F5"}) {
+		t.Error("equal bindings differ")
+	}
+	if SameHotkeys(map[string]string{HotkeyBackup: "F5"}, map[string]string{HotkeyBackup: "F6"}) {
+		t.Error("changed binding is the same")
+	}
+	if SameHotkeys(nil, map[string]string{HotkeyRestoreLatest: "F6"}) {
+		t.Error("added binding is the same")
+	}
+}
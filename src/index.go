@@ -0,0 +1,251 @@
+package main
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// 游戏写入存档后是否自动备份
+var backup_on_save = DefaultConfig().BackupOnSave
+
+// 合并短时间内的多次文件变化
+const (
+	indexDebounce = 300 * time.Millisecond
+	// 游戏保存时会依次写入多个文件, 等待写完再备份
+	saveDebounce = 2 * time.Second
+	// 工具自己写完存档后, 文件变化事件可能稍后才到达
+	pauseGrace = time.Second
+)
+
+// @title: BackupIndex
+// @description: 内存中的备份列表, 监听备份目录增量更新, 并在游戏写入存档时触发备份
+type BackupIndex struct {
+	lock      sync.Mutex
+	root      string
+	data      string
+	backups   map[string]BackupInfo
+	watcher   *fsnotify.Watcher
+	timers    map[string]*time.Timer
+	listeners []func(backups []BackupInfo)
+	// 工具自己正在写入存档目录的次数, 以及最后一次写完的时间
+	paused  int
+	resumed time.Time
+}
+
+// 备份列表
+var backup_index = &BackupIndex{backups: map[string]BackupInfo{}, timers: map[string]*time.Timer{}}
+
+// @title: BackupIndex::Subscribe
+// @description: 备份列表变化时调用回调, 订阅时立即调用一次
+// @param: listener func([]BackupInfo) 回调, 参数为最新的在前的备份列表
+func (x *BackupIndex) Subscribe(listener func(backups []BackupInfo)) {
+	x.lock.Lock()
+	x.listeners = append(x.listeners, listener)
+	x.lock.Unlock()
+	listener(x.Backups())
+}
+
+// @title: BackupIndex::Backups
+// @description: 当前的备份列表, 最新的在前
+// @return: []BackupInfo
+func (x *BackupIndex) Backups() []BackupInfo {
+	x.lock.Lock()
+	defer x.lock.Unlock()
+	backups := make([]BackupInfo, 0, len(x.backups))
+	for _, b := range x.backups {
+		backups = append(backups, b)
+	}
+	sortBackups(backups)
+	return backups
+}
+
+// @title: BackupIndex::Watch
+// @description: 重新读取备份目录并开始监听, 目录变化时再次调用即可
+// @param: root string 备份目录
+// @param: data string 存档目录
+// @return: error
+func (x *BackupIndex) Watch(root, data string) error {
+	x.lock.Lock()
+	if x.watcher != nil && x.root == root && x.data == data {
+		x.lock.Unlock()
+		return nil
+	}
+	if x.watcher != nil {
+		x.watcher.Close()
+		x.watcher = nil
+	}
+	x.root, x.data = root, data
+	x.lock.Unlock()
+
+	backups, err := listBackupsIn(root)
+	if err != nil {
+		return err
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	if err := watcher.Add(root); err != nil {
+		watcher.Close()
+		return err
+	}
+	// 备份信息写在备份文件夹中, 需要监听每个备份
+	for _, b := range backups {
+		watcher.Add(filepath.Join(root, b.Name))
+	}
+	if IsDir(data) {
+		if err := watcher.Add(data); err != nil {
+			log.Println("监听存档目录失败:", err)
+		}
+	}
+
+	x.lock.Lock()
+	x.watcher = watcher
+	x.backups = map[string]BackupInfo{}
+	for _, b := range backups {
+		x.backups[b.Name] = b
+	}
+	x.lock.Unlock()
+	x.notify()
+
+	go x.run(watcher, root, data)
+	return nil
+}
+
+// retarget 已经在监听时, 切换到新的备份目录和存档目录
+func (x *BackupIndex) retarget(root, data string) {
+	x.lock.Lock()
+	watching := x.watcher != nil
+	x.lock.Unlock()
+	if !watching {
+		return
+	}
+	MakeDir(root)
+	if err := x.Watch(root, data); err != nil {
+		log.Println("监听备份目录失败:", err)
+	}
+}
+
+// run 处理文件变化
+func (x *BackupIndex) run(watcher *fsnotify.Watcher, root, data string) {
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if rel, ok := relativeTo(root, event.Name); ok {
+				// 备份目录下第一级为备份文件夹
+				name := strings.SplitN(filepath.ToSlash(rel), "/", 2)[0]
+				if rel == name && event.Op&fsnotify.Create != 0 && IsDir(event.Name) {
+					watcher.Add(event.Name)
+				}
+				x.debounce("backup:"+name, indexDebounce, func() { x.reload(root, name) })
+			} else if _, ok := relativeTo(data, event.Name); ok && event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) != 0 && !x.savePaused() {
+				x.debounce("data", saveDebounce, x.onSaveChanged)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Println("监听备份目录失败:", err)
+		}
+	}
+}
+
+// debounce 合并同一个键在delay内的多次调用
+func (x *BackupIndex) debounce(key string, delay time.Duration, f func()) {
+	x.lock.Lock()
+	defer x.lock.Unlock()
+	if timer, ok := x.timers[key]; ok {
+		timer.Stop()
+	}
+	x.timers[key] = time.AfterFunc(delay, f)
+}
+
+// reload 重新读取单个备份
+func (x *BackupIndex) reload(root, name string) {
+	info, ok := readBackupInfo(root, name)
+	x.lock.Lock()
+	if x.root != root {
+		x.lock.Unlock()
+		return
+	}
+	if ok {
+		x.backups[name] = info
+	} else {
+		delete(x.backups, name)
+	}
+	x.lock.Unlock()
+	x.notify()
+}
+
+// notify 通知所有订阅者
+func (x *BackupIndex) notify() {
+	backups := x.Backups()
+	x.lock.Lock()
+	listeners := append([]func([]BackupInfo){}, x.listeners...)
+	x.lock.Unlock()
+	for _, listener := range listeners {
+		listener(backups)
+	}
+}
+
+// @title: BackupIndex::PauseSave
+// @description: 工具自己写入存档目录(恢复、修改存档)期间不触发存档备份
+// @return: func() 写完后调用
+func (x *BackupIndex) PauseSave() func() {
+	x.lock.Lock()
+	x.paused++
+	// 写入前的存档变化已经被覆盖, 不再备份
+	if timer, ok := x.timers["data"]; ok {
+		timer.Stop()
+		delete(x.timers, "data")
+	}
+	x.lock.Unlock()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			x.lock.Lock()
+			x.paused--
+			x.resumed = time.Now()
+			x.lock.Unlock()
+		})
+	}
+}
+
+// savePaused 是否正在忽略存档目录的变化
+func (x *BackupIndex) savePaused() bool {
+	x.lock.Lock()
+	defer x.lock.Unlock()
+	return x.paused > 0 || time.Since(x.resumed) < pauseGrace
+}
+
+// onSaveChanged 游戏写入存档后备份
+func (x *BackupIndex) onSaveChanged() {
+	if !backup_on_save || x.savePaused() {
+		return
+	}
+	if _, err := CreateBackup(TriggerSave); err != nil {
+		log.Println(err)
+		return
+	}
+	if _, err := PruneBackups(max_backups); err != nil {
+		log.Println(err)
+	}
+}
+
+// relativeTo path在dir下时返回相对路径
+func relativeTo(dir, path string) (string, bool) {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(os.PathSeparator)) {
+		return "", false
+	}
+	return rel, true
+}
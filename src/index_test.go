@@ -0,0 +1,104 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBackupIndexPauseSave(t *testing.T) {
+	x := &BackupIndex{backups: map[string]BackupInfo{}, timers: map[string]*time.Timer{}}
+	fired := make(chan struct{}, 1)
+	x.debounce("data", 50*time.Millisecond, func() { fired <- struct{}{} })
+
+	resume := x.PauseSave()
+	inner := x.PauseSave()
+	inner()
+	if !x.savePaused() {
+		t.Fatal("savePaused = false while a write is in progress")
+	}
+	resume()
+	resume()
+	if x.paused != 0 {
+		t.Fatalf("paused = %d after resume", x.paused)
+	}
+	// 写完后的短时间内仍然忽略
+	if !x.savePaused() {
+		t.Fatal("savePaused = false right after resume")
+	}
+	x.resumed = time.Now().Add(-pauseGrace)
+	if x.savePaused() {
+		t.Fatal("savePaused = true after the grace period")
+	}
+
+	select {
+	case <-fired:
+		t.Fatal("pending save backup was not cancelled")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+// waitBackups 等待备份目录中触发方式为trigger的备份达到count个
+func waitBackups(t *testing.T, root, trigger string, count int, timeout time.Duration) int {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for {
+		backups, err := listBackupsIn(root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		n := 0
+		for _, b := range backups {
+			if b.Trigger == trigger {
+				n++
+			}
+		}
+		if n >= count || time.Now().After(deadline) {
+			return n
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestSaveAndBackupSkipsSaveBackup(t *testing.T) {
+	root, data := t.TempDir(), t.TempDir()
+	old_backup, old_data, old_on_save := backup_path, data_path, backup_on_save
+	backup_path, data_path, backup_on_save = root, data, true
+	defer func() { backup_path, data_path, backup_on_save = old_backup, old_data, old_on_save }()
+	// 其他测试刚修改过存档时不应影响这里
+	backup_index.lock.Lock()
+	backup_index.resumed = time.Time{}
+	backup_index.lock.Unlock()
+	if err := backup_index.Watch(root, data); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		backup_index.lock.Lock()
+		backup_index.watcher.Close()
+		backup_index.watcher = nil
+		backup_index.lock.Unlock()
+	}()
+
+	// 游戏自己写入存档时触发存档备份
+	if err := os.WriteFile(filepath.Join(data, "game1_1.dat"), []byte("game"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if n := waitBackups(t, root, TriggerSave, 1, saveDebounce+2*time.Second); n != 1 {
+		t.Fatalf("save backups = %d after the game wrote a save", n)
+	}
+
+	// 工具调用游戏保存时只有这一次备份
+	_, err := saveAndBackup(TriggerManual, &Board{BoardState: BoardState{Level: 3}}, func() {
+		os.WriteFile(filepath.Join(data, "game1_1.dat"), []byte("tool"), 0644)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := waitBackups(t, root, TriggerManual, 1, 0); n != 1 {
+		t.Fatalf("manual backups = %d", n)
+	}
+	if n := waitBackups(t, root, TriggerSave, 2, saveDebounce+pauseGrace+time.Second); n != 1 {
+		t.Fatalf("save backups = %d after a save triggered by the tool", n)
+	}
+}
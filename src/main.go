@@ -1,21 +1,36 @@
 package main
 
 import (
+	"errors"
 	"log"
 	"os"
+	"strings"
 	"time"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/app"
 	"fyne.io/fyne/v2/container"
 	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/driver/desktop"
 	"fyne.io/fyne/v2/widget"
 )
 
-var auto_save = false
+var auto_save = DefaultConfig().AutoSave
 var backup_list = []string{}
 var select_backup = ""
 
+// 最多保留的备份数量
+var max_backups = DefaultConfig().MaxBackups
+
+// 自动保存间隔
+var auto_save_interval = time.Duration(DefaultConfig().AutoSaveInterval) * time.Second
+
+// 游戏存档目录
+var data_path = DefaultConfig().DataDir
+
+// 游戏窗口标题, 用于查找游戏窗口
+var game_title = DefaultConfig().GameTitle
+
 // pvz窗口
 var pvz = &pvzWindow{
 	Handle:        0,
@@ -26,27 +41,64 @@ var pvz = &pvzWindow{
 }
 
 func main() {
+	// 读取配置
+	if err := LoadConfig(); err != nil {
+		log.Println("读取配置失败:", err)
+	}
+	// 配置的存档目录不存在时自动查找, 其他存档配置的目录由用户指定
+	if dir, changed := ResolveDataDir(data_path); changed && CurrentConfig().Profile().Name == DefaultProfileName {
+		if err := UpdateConfig(func(c *Config) { c.DataDir = dir }); err != nil {
+			log.Println(err)
+		}
+	}
+
+	// 带参数启动时作为命令行工具运行
+	if len(os.Args) > 1 {
+		os.Exit(RunCLI(os.Args[1:]))
+	}
+
 	// 初始化操作
 	// 判断当前目录下是否存在backup目录，如果不存在则创建
-	backup_exist, _ := PathExists("backup")
+	backup_exist, _ := PathExists(backup_path)
 	if !backup_exist {
-		os.Mkdir("backup", os.ModePerm)
+		os.Mkdir(backup_path, os.ModePerm)
 	}
 
 	// 创建一个app
 	app := app.New()
 	w := app.NewWindow("pvzHE utils")
+	notifier = app.SendNotification
 	// w.Resize(fyne.NewSize(200, 200))
 	auto_save_checkbox := widget.NewCheck("Auto Save", func(b bool) {
-		auto_save = b
+		if b == CurrentConfig().AutoSave {
+			return
+		}
+		// 保存到配置, 下次启动时保持
+		if err := UpdateConfig(func(c *Config) { c.AutoSave = b }); err != nil {
+			log.Println(err)
+		}
 	})
-	backup_select := widget.NewSelect(backup_list, func(s string) {
+	auto_save_checkbox.SetChecked(auto_save)
+	// 选中备份的关卡存档预览
+	preview_label := widget.NewLabel("")
+	preview_label.Wrapping = fyne.TextWrapWord
+	backup_browser := NewBackupBrowser(w, func(s string) {
 		select_backup = s
+		if s == "" {
+			preview_label.SetText("")
+			return
+		}
+		preview_label.SetText(strings.Join(append(DescribeBackup(s), DescribeSnapshot(SnapshotPath(s))...), "\n"))
+	})
+	backup_button := widget.NewButton("backup now", func() {
+		ShowBackupNow(w, func(name string) {
+			dialog.NewInformation("Success", "Backed up to "+name, w).Show()
+		})
 	})
 	recover_button := widget.NewButton("recover", func() {
 		// 恢复存档
-		// 将选中的备份文件夹下的文件拷贝到C:\ProgramData\PopCap Games\PlantsVsZombies\pvzHE\yourdata
-		err := CopyDir("backup\\"+select_backup, "C:\\ProgramData\\PopCap Games\\PlantsVsZombies\\pvzHE\\yourdata")
+		// 将选中的备份文件夹下的文件拷贝到存档目录
+		err := RestoreBackup(select_backup)
 		if err != nil {
 			// 如果出现错误则弹出错误提示
 			dialog.NewInformation("Error", err.Error(), w).Show()
@@ -56,9 +108,43 @@ func main() {
 		}
 	})
 	recover_button.Disable()
+	// 按文件恢复, 可以只恢复备份中的部分文件
+	files_button := widget.NewButton("recover files", func() {
+		ShowRestoreFiles(select_backup, w)
+	})
+	files_button.Disable()
+
+	diff_button := widget.NewButton("diff", func() {
+		ShowDiff(w)
+	})
 
 	info_label := widget.NewLabel("Please close the game before recovering.")
 
+	settings_tab, refresh_settings := NewSettingsTab(w)
+	profiles_tab, refresh_profiles := NewProfilesTab(w)
+	dashboard_tab, refresh_dashboard := NewDashboardTab()
+	trainer_tab, refresh_trainer := NewTrainerTab(w)
+	script_tab, refresh_script := NewScriptTab(w)
+	stats_tab, refresh_stats := NewStatsTab(w)
+	refresh_tray := SetupTray(app, w)
+	// 全屏游戏时通过全局热键备份和恢复
+	hotkeys := NewHotkeyManager(NewWinHotkeyBackend(), HotkeyActions())
+	applied_hotkeys := CurrentConfig().Hotkeys
+	if err := hotkeys.Apply(applied_hotkeys); err != nil {
+		log.Println(err)
+	}
+	// 供外部工具和直播叠加层使用的本地API
+	if err := api_service.Apply(CurrentConfig().API); err != nil {
+		log.Println("启动本地API失败:", err)
+	}
+	// 自动化规则
+	automation.Load(CurrentConfig().Script)
+	stop_automation := automation.Run(game_events)
+	// 记录游戏历史
+	history := NewHistoryRecorder(HistoryPath())
+	history.OnRecord(func(GameEvent) { refresh_stats() })
+	stop_history := history.Run(game_events)
+
 	// 判断是否以管理员权限运行
 	admin_status, _ := IsAdmin()
 	if !admin_status {
@@ -69,11 +155,60 @@ func main() {
 			}),
 		))
 	} else {
-		w.SetContent(container.NewVBox(
-			auto_save_checkbox, backup_select, recover_button, info_label,
+		w.SetContent(container.NewAppTabs(
+			container.NewTabItem("Backup", container.NewBorder(
+				container.NewBorder(nil, nil, nil, backup_button, auto_save_checkbox),
+				container.NewVBox(preview_label, container.NewGridWithColumns(3, recover_button, files_button, diff_button), info_label),
+				nil, nil,
+				backup_browser.Widget(),
+			)),
+			container.NewTabItem("Dashboard", container.NewVScroll(container.NewVBox(dashboard_tab, NewMusicControls(w)))),
+			container.NewTabItem("Trainer", trainer_tab),
+			container.NewTabItem("Editor", NewEditorTab(w)),
+			container.NewTabItem("Profiles", profiles_tab),
+			container.NewTabItem("Scripts", script_tab),
+			container.NewTabItem("Stats", stats_tab),
+			container.NewTabItem("Settings", settings_tab),
 		))
 	}
 
+	// 配置文件被修改后刷新界面
+	on_config_change = func(c Config) {
+		auto_save_checkbox.SetChecked(c.AutoSave)
+		refresh_settings(c)
+		refresh_profiles(c)
+		refresh_tray(c)
+		// 热键没有变化时不重新注册
+		if !SameHotkeys(c.Hotkeys, applied_hotkeys) {
+			applied_hotkeys = c.Hotkeys
+			if err := hotkeys.Apply(c.Hotkeys); err != nil {
+				log.Println(err)
+			}
+		}
+		if err := api_service.Apply(c.API); err != nil {
+			log.Println("启动本地API失败:", err)
+		}
+		automation.Load(c.Script)
+		refresh_script(c)
+		MakeDir(backup_path)
+	}
+	if err := WatchConfig(); err != nil {
+		log.Println("监听配置文件失败:", err)
+	}
+
+	// 备份目录变化时更新backup_list和备份列表
+	backup_index.Subscribe(func(backups []BackupInfo) {
+		names := []string{}
+		for _, backup := range backups {
+			names = append(names, backup.Name)
+		}
+		backup_list = names
+		backup_browser.SetBackups(backups)
+	})
+	if err := backup_index.Watch(backup_path, data_path); err != nil {
+		log.Println("监听备份目录失败:", err)
+	}
+
 	// 开启携程进行自动保存操作，每30s保存一次
 	go func() {
 		for {
@@ -81,88 +216,60 @@ func main() {
 				// 保存操作
 				// 判断游戏界面是否在游戏中
 				ui := pvz.GetGameUI()
-				if ui == 3 {
-					// 修复保存后音乐暂停的问题
-					// 修改内存
-					pvz.WriteMemory(ToBytes(106), 2, 0x408d4b)
-
-					// 调用游戏保存
-					pvz.CallSave()
-
-					// 修改内存
-					pvz.WriteMemory(ToBytes(362), 2, 0x408d4b)
-
-					// 创建以当前时间为文件名的备份文件夹
-					backup_name := time.Now().Format("2006.01.02 15-04-05")
-					backup_dir := "backup/" + backup_name
-					err := os.Mkdir(backup_dir, os.ModePerm)
-					if err != nil {
+				if ui == GameUIPlaying {
+					// 调用游戏保存并拷贝存档到以当前时间为文件名的备份文件夹
+					if _, err := SaveAndBackup(TriggerAuto); err != nil {
 						log.Println(err)
 					}
-					// 拷贝C:\ProgramData\PopCap Games\PlantsVsZombies\pvzHE\yourdata这个文件夹到备份文件夹
-					CopyDir("C:\\ProgramData\\PopCap Games\\PlantsVsZombies\\pvzHE\\yourdata", backup_dir)
 				}
 			}
-			// 判断备份文件夹下的文件数量，如果超过10个则删除至10个
-			// 获取备份文件夹下的所有文件
-			backup_files, _ := os.ReadDir("backup")
-			// 如果文件数量超过10个则删除多余的文件
-			if len(backup_files) > 10 {
-				for i := 0; i < len(backup_files)-10; i++ {
-					os.RemoveAll("backup/" + backup_files[i].Name())
-				}
+			// 判断备份数量，如果超过上限则删除最旧的
+			if _, err := PruneBackups(max_backups); err != nil {
+				log.Println(err)
 			}
-			// 休眠30s
-			time.Sleep(30 * time.Second)
+			// 休眠
+			time.Sleep(auto_save_interval)
 		}
 	}()
 
 	// 开启携程监测状态,1s更新一次
 	go func() {
 		for {
-			// 读取backup目录下的所有文件夹，存入backup_list,更新backup_select
-			backup_files, _ := os.ReadDir("backup")
-			backup_list = []string{}
-			for _, file := range backup_files {
-				backup_list = append(backup_list, file.Name())
-			}
-			for i, j := 0, len(backup_list)-1; i < j; i, j = i+1, j-1 {
-				backup_list[i], backup_list[j] = backup_list[j], backup_list[i]
-			}
-			backup_select.SetOptions(backup_list)
-
-			// 判断程序是否还在运行
-			is_running := CheckWindowTitle("植物大战僵尸杂交版")
+			// 判断程序是否还在运行, 在运行则连接游戏进程
+			is_running := AttachGame()
+			PollGameEvents(is_running)
 			if is_running {
 				auto_save_checkbox.Enable()
+				board, err := ReadBoard(pvz)
+				var entities *Entities
+				if err == nil {
+					entities, _ = ReadEntities(pvz)
+				}
+				refresh_dashboard(board, entities, err)
+				music.Enforce()
+				refresh_trainer()
 			} else {
 				auto_save_checkbox.Disable()
-				auto_save_checkbox.SetChecked(false)
+				refresh_dashboard(nil, nil, errors.New("game is not running"))
+				refresh_trainer()
 			}
 			// 只有在游戏未运行且选中了备份文件夹才能恢复
+			can_recover := false
 			if select_backup != "" {
 				if !is_running {
-					recover_button.Enable()
+					can_recover = true
 				} else {
-					ui := pvz.GetGameUI()
-					if ui != 3 && ui != 4 && ui != 2 {
-						recover_button.Enable()
-					} else {
-						recover_button.Disable()
+					if !pvz.GetGameUI().InLevel() {
+						can_recover = true
 					}
 				}
+			}
+			if can_recover {
+				recover_button.Enable()
+				files_button.Enable()
 			} else {
 				recover_button.Disable()
-			}
-
-			if is_running {
-				if !pvz.IsValid() {
-					pvz.Handle = FindWindow("MainWindow", pvz.title)
-					if pvz.Handle != 0 {
-						GetWindowThreadProcessId(pvz.Handle, &pvz.Pid)
-						pvz.ProcessHandle = OpenProcess(PROCESS_ALL_ACCESS, 0, pvz.Pid)
-					}
-				}
+				files_button.Disable()
 			}
 
 			// 休眠0.5s
@@ -170,6 +277,16 @@ func main() {
 		}
 	}()
 
-	w.Resize(fyne.NewSize(300, 200))
-	w.ShowAndRun()
+	w.Resize(fyne.NewSize(720, 480))
+	// 只有托盘可用时才能最小化启动, 否则无法再打开窗口
+	if _, ok := app.(desktop.App); ok && CurrentConfig().StartMinimized {
+		app.Run()
+	} else {
+		w.ShowAndRun()
+	}
+	// 退出时恢复修改器修改的代码
+	patches.RevertAll()
+	api_service.Close()
+	stop_automation()
+	stop_history()
 }
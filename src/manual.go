@@ -0,0 +1,84 @@
+package main
+
+import (
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// @title: ManualBackup
+// @description: 立即备份并记录名称、备注和标签, 在任何游戏界面都可以使用
+// @param: label string 名称
+// @param: note string 备注
+// @param: tags []string 标签
+// @return: string 备份名, error
+func ManualBackup(label, note string, tags []string) (string, error) {
+	AttachGame()
+	backup_name, err := SaveAndBackup(TriggerManual)
+	if err != nil {
+		return backup_name, err
+	}
+	if label == "" && note == "" && len(tags) == 0 {
+		return backup_name, nil
+	}
+	return backup_name, AnnotateBackup(backup_name, label, note, tags)
+}
+
+// @title: ShowBackupNow
+// @description: 弹出立即备份的对话框, 可填写名称、备注和标签
+// @param: w fyne.Window 父窗口
+// @param: done func(string) 备份成功后的回调
+func ShowBackupNow(w fyne.Window, done func(name string)) {
+	label_entry := widget.NewEntry()
+	label_entry.SetPlaceHolder("optional")
+	note_entry := widget.NewMultiLineEntry()
+	note_entry.SetPlaceHolder("optional")
+	tags_entry := widget.NewEntry()
+	tags_entry.SetPlaceHolder("comma separated")
+
+	items := []*widget.FormItem{
+		widget.NewFormItem("name", label_entry),
+		widget.NewFormItem("note", note_entry),
+		widget.NewFormItem("tags", tags_entry),
+	}
+	d := dialog.NewForm("Backup now", "Backup", "Cancel", items, func(ok bool) {
+		if !ok {
+			return
+		}
+		backup_name, err := ManualBackup(label_entry.Text, note_entry.Text, ParseTags(tags_entry.Text))
+		if err != nil {
+			dialog.NewInformation("Error", err.Error(), w).Show()
+			return
+		}
+		done(backup_name)
+	}, w)
+	d.Resize(fyne.NewSize(400, 300))
+	d.Show()
+}
+
+// @title: DescribeBackup
+// @description: 备份的名称、备注和标签, 用于预览
+// @param: name string 备份名
+// @return: []string
+func DescribeBackup(name string) []string {
+	meta, err := ReadBackupMeta(name)
+	if err != nil {
+		return nil
+	}
+	lines := []string{}
+	if meta.Label != "" {
+		lines = append(lines, meta.Label)
+	}
+	if meta.Note != "" {
+		lines = append(lines, meta.Note)
+	}
+	if len(meta.Tags) > 0 {
+		lines = append(lines, "#"+strings.Join(meta.Tags, " #"))
+	}
+	if meta.Board != nil {
+		lines = append(lines, "board: "+meta.Board.Summary())
+	}
+	return lines
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+)
+
+// @title: MemoryImage
+// @description: 内存镜像, 按地址保存若干段内存, 用于在没有游戏进程时读取对象
+type MemoryImage struct {
+	// 起始地址到内容
+	Segments map[uint32][]byte
+}
+
+// @title: NewMemoryImage
+// @description: 创建空的内存镜像
+// @return: *MemoryImage
+func NewMemoryImage() *MemoryImage {
+	return &MemoryImage{Segments: map[uint32][]byte{}}
+}
+
+// @title: MemoryImage::Write
+// @description: 写入一段内存
+// @param: address uint32 起始地址
+// @param: data []byte 内容
+func (m *MemoryImage) Write(address uint32, data []byte) {
+	m.Segments[address] = data
+}
+
+// @title: MemoryImage::WritePointer
+// @description: 在address写入4字节的指针或整数
+// @param: address uint32 地址
+// @param: value uint32 值
+func (m *MemoryImage) WritePointer(address, value uint32) {
+	b := make([]byte, 4)
+	binary.LittleEndian.PutUint32(b, value)
+	m.Write(address, b)
+}
+
+// @title: MemoryImage::ReadBytes
+// @description: 按多级偏移读取内存, 与pvzWindow::ReadBytes相同
+// @param: size int 读取字节数
+// @param: address ...int 内存地址(可以多级偏移)
+// @return: []byte, error
+func (m *MemoryImage) ReadBytes(size int, address ...int) ([]byte, error) {
+	var offset uint32 = 0
+	for i := 0; i < len(address)-1; i++ {
+		pointer, err := m.read(offset+uint32(address[i]), 4)
+		if err != nil {
+			return nil, err
+		}
+		offset = binary.LittleEndian.Uint32(pointer)
+		if offset == 0 {
+			return nil, fmt.Errorf("空指针!")
+		}
+	}
+	return m.read(offset+uint32(address[len(address)-1]), size)
+}
+
+// @title: MemoryImage::WriteBytes
+// @description: 按多级偏移写入内存, 只能写入已有的段
+// @param: data []byte 要写入的字节
+// @param: address ...int 内存地址(可以多级偏移)
+// @return: error
+func (m *MemoryImage) WriteBytes(data []byte, address ...int) error {
+	if _, err := m.ReadBytes(len(data), address...); err != nil {
+		return err
+	}
+	var offset uint32 = 0
+	for i := 0; i < len(address)-1; i++ {
+		pointer, _ := m.read(offset+uint32(address[i]), 4)
+		offset = binary.LittleEndian.Uint32(pointer)
+	}
+	target := offset + uint32(address[len(address)-1])
+	for start, segment := range m.Segments {
+		if target >= start && uint64(target)+uint64(len(data)) <= uint64(start)+uint64(len(segment)) {
+			copy(segment[target-start:], data)
+			return nil
+		}
+	}
+	return fmt.Errorf("地址 %#x 不可写", target)
+}
+
+// read 读取连续的一段内存, 必须完整落在一段中
+func (m *MemoryImage) read(address uint32, size int) ([]byte, error) {
+	starts := []uint32{}
+	for start := range m.Segments {
+		starts = append(starts, start)
+	}
+	sort.Slice(starts, func(i, j int) bool { return starts[i] < starts[j] })
+	for _, start := range starts {
+		data := m.Segments[start]
+		if address >= start && uint64(address)+uint64(size) <= uint64(start)+uint64(len(data)) {
+			out := make([]byte, size)
+			copy(out, data[address-start:])
+			return out, nil
+		}
+	}
+	return nil, fmt.Errorf("地址 %#x 不可读", address)
+}
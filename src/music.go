@@ -0,0 +1,231 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// 不播放音乐
+const MusicNone MusicID = 0
+
+// @title: MusicController
+// @description: 控制游戏背景音乐, 保存时保持当前音乐, 可以锁定音乐
+type MusicController struct {
+	lock sync.Mutex
+	// 锁定的音乐, 为MusicNone时不锁定
+	locked MusicID
+}
+
+// 音乐控制
+var music = &MusicController{}
+
+// @title: MusicController::Current
+// @description: 当前播放的音乐
+// @return: MusicID, error
+func (m *MusicController) Current() (MusicID, error) {
+	if !pvz.IsValid() {
+		return MusicNone, errors.New("游戏未运行")
+	}
+	return pvz.GetMusicID(), nil
+}
+
+// @title: MusicController::Paused
+// @description: 音乐是否被游戏暂停, 暂停时音乐ID不变
+// @return: bool, error
+func (m *MusicController) Paused() (bool, error) {
+	if !pvz.IsValid() {
+		return false, errors.New("游戏未运行")
+	}
+	b, err := pvz.ReadBytes(1, lawnAppBase, lawnAppMusicOffset, musicPausedOffset)
+	if err != nil {
+		return false, err
+	}
+	return b[0] != 0, nil
+}
+
+// @title: MusicController::Play
+// @description: 播放音乐, 正在播放同一首时从头播放
+// @param: id MusicID
+// @return: error
+func (m *MusicController) Play(id MusicID) error {
+	if !pvz.IsValid() {
+		return errors.New("游戏未运行")
+	}
+	// 游戏在音乐相同时不会重新播放, 先停止
+	if pvz.GetMusicID() == id {
+		pvz.PlayMusic(MusicNone)
+	}
+	pvz.PlayMusic(id)
+	return nil
+}
+
+// @title: MusicController::Stop
+// @description: 停止播放音乐
+// @return: error
+func (m *MusicController) Stop() error {
+	if !pvz.IsValid() {
+		return errors.New("游戏未运行")
+	}
+	pvz.PlayMusic(MusicNone)
+	return nil
+}
+
+// @title: MusicController::Next
+// @description: 播放下一首音乐
+// @return: MusicID, error
+func (m *MusicController) Next() (MusicID, error) {
+	current, err := m.Current()
+	if err != nil {
+		return MusicNone, err
+	}
+	tracks := MusicTracks()
+	next := tracks[0]
+	for i, id := range tracks {
+		if id == current && i+1 < len(tracks) {
+			next = tracks[i+1]
+		}
+	}
+	return next, m.Play(next)
+}
+
+// @title: MusicController::Lock
+// @description: 锁定音乐, 游戏切换音乐后会重新播放锁定的音乐, MusicNone表示取消锁定
+// @param: id MusicID
+func (m *MusicController) Lock(id MusicID) {
+	m.lock.Lock()
+	m.locked = id
+	m.lock.Unlock()
+}
+
+// @title: MusicController::Locked
+// @description: 锁定的音乐
+// @return: MusicID
+func (m *MusicController) Locked() MusicID {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.locked
+}
+
+// @title: MusicController::Enforce
+// @description: 当前音乐不是锁定的音乐时重新播放, 在监测游戏状态时调用
+func (m *MusicController) Enforce() {
+	locked := m.Locked()
+	if locked == MusicNone || !pvz.IsValid() || pvz.GetGameUI() == GameUILoading {
+		return
+	}
+	if pvz.GetMusicID() != locked {
+		pvz.PlayMusic(locked)
+	}
+}
+
+// @title: MusicController::Preserve
+// @description: 执行f, 执行后音乐被暂停或发生变化时恢复之前的音乐, 用于调用游戏保存
+// 游戏保存后会暂停音乐, 重新播放会清除暂停状态, 音乐从头开始
+// @param: f func()
+func (m *MusicController) Preserve(f func()) {
+	before, err := m.Current()
+	f()
+	if err != nil || before == MusicNone {
+		return
+	}
+	after, err := m.Current()
+	if err != nil {
+		return
+	}
+	if paused, err := m.Paused(); after != before || (err == nil && paused) {
+		m.Play(before)
+	}
+}
+
+// @title: MusicTracks
+// @description: 所有音乐, 按ID排序
+// @return: []MusicID
+func MusicTracks() []MusicID {
+	tracks := []MusicID{}
+	for id := range version_profile.Music {
+		tracks = append(tracks, MusicID(id))
+	}
+	sort.Slice(tracks, func(i, j int) bool { return tracks[i] < tracks[j] })
+	return tracks
+}
+
+// @title: ParseMusic
+// @description: 按ID或名称查找音乐
+// @param: s string
+// @return: MusicID, error
+func ParseMusic(s string) (MusicID, error) {
+	if id, err := strconv.Atoi(s); err == nil {
+		return MusicID(id), nil
+	}
+	for _, id := range MusicTracks() {
+		if id.String() == s {
+			return id, nil
+		}
+	}
+	return MusicNone, fmt.Errorf("未知的音乐 %s", s)
+}
+
+// @title: NewMusicControls
+// @description: 音乐控制
+// @param: w fyne.Window 父窗口
+// @return: fyne.CanvasObject
+func NewMusicControls(w fyne.Window) fyne.CanvasObject {
+	names := []string{}
+	for _, id := range MusicTracks() {
+		names = append(names, id.String())
+	}
+	track_select := widget.NewSelect(names, nil)
+	selected := func() (MusicID, bool) {
+		id, err := ParseMusic(track_select.Selected)
+		return id, err == nil
+	}
+	report := func(err error) {
+		if err != nil {
+			dialog.NewInformation("Error", err.Error(), w).Show()
+		}
+	}
+
+	lock_check := widget.NewCheck("lock track", func(b bool) {
+		locked := MusicNone
+		if b {
+			id, ok := selected()
+			if !ok {
+				return
+			}
+			locked = id
+		}
+		report(UpdateConfig(func(c *Config) { c.LockedMusic = locked }))
+	})
+	if locked := CurrentConfig().LockedMusic; locked != MusicNone {
+		track_select.SetSelected(locked.String())
+		lock_check.SetChecked(true)
+	}
+
+	play_button := widget.NewButton("play", func() {
+		if id, ok := selected(); ok {
+			report(music.Play(id))
+		}
+	})
+	stop_button := widget.NewButton("stop", func() {
+		report(music.Stop())
+	})
+	next_button := widget.NewButton("next", func() {
+		id, err := music.Next()
+		if err == nil {
+			track_select.SetSelected(id.String())
+		}
+		report(err)
+	})
+	return widget.NewCard("", "music", container.NewVBox(
+		container.NewBorder(nil, nil, nil, lock_check, track_select),
+		container.NewGridWithColumns(3, play_button, stop_button, next_button),
+	))
+}
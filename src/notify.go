@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fyne.io/fyne/v2"
+)
+
+// 通知的事件
+const (
+	NotifyBackup       = "backup"        // 备份完成
+	NotifyBackupFailed = "backup_failed" // 备份失败
+	NotifyRestore      = "restore"       // 恢复完成或失败
+	NotifyGame         = "game"          // 游戏启动或退出
+)
+
+// @title: NotifySettings
+// @description: 各事件是否发送桌面通知
+type NotifySettings struct {
+	Backup       bool `json:"backup"`
+	BackupFailed bool `json:"backup_failed"`
+	Restore      bool `json:"restore"`
+	Game         bool `json:"game"`
+}
+
+// @title: NotifySettings::Enabled
+// @description: 事件是否需要通知
+// @param: event string 事件
+// @return: bool
+func (s NotifySettings) Enabled(event string) bool {
+	switch event {
+	case NotifyBackup:
+		return s.Backup
+	case NotifyBackupFailed:
+		return s.BackupFailed
+	case NotifyRestore:
+		return s.Restore
+	case NotifyGame:
+		return s.Game
+	}
+	return false
+}
+
+// 发送桌面通知, 命令行模式下为空
+var notifier func(n *fyne.Notification)
+
+// @title: Notify
+// @description: 按设置发送桌面通知
+// @param: event string 事件
+// @param: title string 标题
+// @param: content string 内容
+func Notify(event, title, content string) {
+	if notifier == nil || !CurrentConfig().Notify.Enabled(event) {
+		return
+	}
+	notifier(fyne.NewNotification(title, content))
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+)
+
+// @title: Patch
+// @description: 对游戏代码的一处修改
+type Patch struct {
+	Address  int
+	Original []byte
+	Patched  []byte
+}
+
+// 补丁状态
+const (
+	PatchOriginal = "original" // 未修改
+	PatchApplied  = "applied"  // 已修改
+	PatchUnknown  = "unknown"  // 内容与两者都不同, 可能是游戏版本不同或被其他修改器修改
+)
+
+// @title: PatchManager
+// @description: 管理成组的补丁, 修改前检查原始字节, 状态直接从内存读取,
+// 因此游戏重启后补丁自然失效
+type PatchManager struct {
+	lock    sync.Mutex
+	memory  WritableMemory
+	groups  map[string][]Patch
+	applied map[string]bool
+}
+
+// @title: NewPatchManager
+// @description: 创建补丁管理器
+// @param: memory WritableMemory 游戏内存
+// @return: *PatchManager
+func NewPatchManager(memory WritableMemory) *PatchManager {
+	return &PatchManager{memory: memory, groups: map[string][]Patch{}, applied: map[string]bool{}}
+}
+
+// @title: PatchManager::Register
+// @description: 注册一组补丁, 同一组的补丁同时修改和恢复
+// @param: name string 组名
+// @param: patches ...Patch
+func (m *PatchManager) Register(name string, patches ...Patch) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.groups[name] = patches
+}
+
+// @title: PatchManager::State
+// @description: 读取一组补丁的状态
+// @param: name string 组名
+// @return: string, error
+func (m *PatchManager) State(name string) (string, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.state(name)
+}
+
+func (m *PatchManager) state(name string) (string, error) {
+	patches, ok := m.groups[name]
+	if !ok {
+		return "", fmt.Errorf("未知的补丁 %s", name)
+	}
+	state := ""
+	for _, p := range patches {
+		current, err := m.memory.ReadBytes(len(p.Original), p.Address)
+		if err != nil {
+			return "", err
+		}
+		s := PatchUnknown
+		if bytes.Equal(current, p.Original) {
+			s = PatchOriginal
+		} else if bytes.Equal(current, p.Patched) {
+			s = PatchApplied
+		}
+		if state != "" && s != state {
+			return PatchUnknown, nil
+		}
+		state = s
+	}
+	return state, nil
+}
+
+// @title: PatchManager::Set
+// @description: 修改或恢复一组补丁, 内存内容与预期不符时不修改
+// @param: name string 组名
+// @param: enabled bool 是否修改
+// @return: error
+func (m *PatchManager) Set(name string, enabled bool) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	state, err := m.state(name)
+	if err != nil {
+		return err
+	}
+	want, from := PatchApplied, PatchOriginal
+	if !enabled {
+		want, from = PatchOriginal, PatchApplied
+	}
+	if state == want {
+		return nil
+	}
+	if state != from {
+		return fmt.Errorf("补丁 %s 的原始字节不匹配, 游戏版本可能不受支持", name)
+	}
+	for _, p := range m.groups[name] {
+		data := p.Patched
+		if !enabled {
+			data = p.Original
+		}
+		if err := m.memory.WriteBytes(data, p.Address); err != nil {
+			return err
+		}
+	}
+	m.applied[name] = enabled
+	return nil
+}
+
+// @title: PatchManager::RevertAll
+// @description: 恢复本次修改过的所有补丁, 退出时调用
+func (m *PatchManager) RevertAll() {
+	m.lock.Lock()
+	names := []string{}
+	for name, applied := range m.applied {
+		if applied {
+			names = append(names, name)
+		}
+	}
+	m.lock.Unlock()
+	for _, name := range names {
+		m.Set(name, false)
+	}
+}
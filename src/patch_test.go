@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+// 测试用内存镜像中的代码地址
+const testCodeAddress = 0x00400000
+
+func newTestPatches() (*PatchManager, *MemoryImage) {
+	m := NewMemoryImage()
+	m.Write(testCodeAddress, []byte{0x74, 0x10, 0x90, 0x6A, 0x01})
+	patches := NewPatchManager(m)
+	patches.Register("jump",
+		Patch{Address: testCodeAddress, Original: []byte{0x74}, Patched: []byte{0xEB}},
+		Patch{Address: testCodeAddress + 3, Original: []byte{0x6A, 0x01}, Patched: []byte{0x6A, 0x00}},
+	)
+	patches.Register("nop", Patch{Address: testCodeAddress + 2, Original: []byte{0x90}, Patched: []byte{0xCC}})
+	return patches, m
+}
+
+func checkPatchState(t *testing.T, patches *PatchManager, name, want string) {
+	t.Helper()
+	if state, err := patches.State(name); err != nil || state != want {
+		t.Fatalf("State(%s) = %s, %v, want %s", name, state, err, want)
+	}
+}
+
+func TestPatchManagerSet(t *testing.T) {
+	patches, m := newTestPatches()
+	checkPatchState(t, patches, "jump", PatchOriginal)
+
+	if err := patches.Set("jump", true); err != nil {
+		t.Fatal(err)
+	}
+	checkPatchState(t, patches, "jump", PatchApplied)
+	if !bytes.Equal(m.Segments[testCodeAddress], []byte{0xEB, 0x10, 0x90, 0x6A, 0x00}) {
+		t.Fatalf("memory = % x", m.Segments[testCodeAddress])
+	}
+	// 重复修改不报错
+	if err := patches.Set("jump", true); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := patches.Set("jump", false); err != nil {
+		t.Fatal(err)
+	}
+	checkPatchState(t, patches, "jump", PatchOriginal)
+	if !bytes.Equal(m.Segments[testCodeAddress], []byte{0x74, 0x10, 0x90, 0x6A, 0x01}) {
+		t.Fatalf("memory = % x", m.Segments[testCodeAddress])
+	}
+
+	if err := patches.Set("missing", true); err == nil {
+		t.Fatal("expected error for an unknown patch")
+	}
+}
+
+func TestPatchManagerMismatch(t *testing.T) {
+	patches, m := newTestPatches()
+	// 原始字节不同, 可能是其他版本的游戏
+	m.Segments[testCodeAddress][3] = 0x50
+	checkPatchState(t, patches, "jump", PatchUnknown)
+	if err := patches.Set("jump", true); err == nil {
+		t.Fatal("expected error when the original bytes do not match")
+	}
+	if !bytes.Equal(m.Segments[testCodeAddress], []byte{0x74, 0x10, 0x90, 0x50, 0x01}) {
+		t.Fatalf("memory changed after a mismatch: % x", m.Segments[testCodeAddress])
+	}
+
+	// 同一组中一处已修改一处未修改
+	patches, m = newTestPatches()
+	m.Segments[testCodeAddress][0] = 0xEB
+	checkPatchState(t, patches, "jump", PatchUnknown)
+}
+
+func TestPatchManagerRevertAll(t *testing.T) {
+	patches, m := newTestPatches()
+	if err := patches.Set("jump", true); err != nil {
+		t.Fatal(err)
+	}
+	if err := patches.Set("nop", true); err != nil {
+		t.Fatal(err)
+	}
+	if err := patches.Set("nop", false); err != nil {
+		t.Fatal(err)
+	}
+	// 只恢复仍处于修改状态的补丁
+	patches.RevertAll()
+	checkPatchState(t, patches, "jump", PatchOriginal)
+	checkPatchState(t, patches, "nop", PatchOriginal)
+	if !bytes.Equal(m.Segments[testCodeAddress], []byte{0x74, 0x10, 0x90, 0x6A, 0x01}) {
+		t.Fatalf("memory = % x", m.Segments[testCodeAddress])
+	}
+}
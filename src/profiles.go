@@ -0,0 +1,279 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// 未选择存档配置时使用的配置名
+const DefaultProfileName = "default"
+
+// @title: SaveProfile
+// @description: 存档配置, 每个配置有独立的存档目录、备份目录和保留数量
+type SaveProfile struct {
+	// 配置名
+	Name string `json:"name"`
+	// 存档目录, 为空时使用全局配置
+	DataDir string `json:"data_dir,omitempty"`
+	// 备份目录
+	BackupDir string `json:"backup_dir"`
+	// 最多保留的备份数量, 为0时使用全局配置
+	MaxBackups int `json:"max_backups,omitempty"`
+}
+
+// @title: Config::Profile
+// @description: 当前使用的存档配置, 未填写的字段使用全局配置
+// @return: SaveProfile
+func (c Config) Profile() SaveProfile {
+	p, ok := c.FindProfile(c.ActiveProfile)
+	if !ok {
+		p = SaveProfile{Name: DefaultProfileName}
+	}
+	if p.DataDir == "" {
+		p.DataDir = c.DataDir
+	}
+	if p.BackupDir == "" {
+		p.BackupDir = c.BackupDir
+	}
+	if p.MaxBackups == 0 {
+		p.MaxBackups = c.MaxBackups
+	}
+	return p
+}
+
+// @title: Config::FindProfile
+// @description: 按名称查找存档配置, default表示全局配置
+// @param: name string 配置名
+// @return: SaveProfile, bool
+func (c Config) FindProfile(name string) (SaveProfile, bool) {
+	if name == "" || name == DefaultProfileName {
+		return SaveProfile{Name: DefaultProfileName, DataDir: c.DataDir, BackupDir: c.BackupDir, MaxBackups: c.MaxBackups}, true
+	}
+	for _, p := range c.Profiles {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return SaveProfile{}, false
+}
+
+// @title: Config::ProfileNames
+// @description: 所有存档配置名, default在最前
+// @return: []string
+func (c Config) ProfileNames() []string {
+	names := []string{DefaultProfileName}
+	for _, p := range c.Profiles {
+		names = append(names, p.Name)
+	}
+	return names
+}
+
+// @title: DefaultProfileBackupDir
+// @description: 存档配置默认的备份目录, 与全局备份目录同级, 不能放在全局备份目录里面, 否则会被当作一个备份
+// @param: backupDir string 全局备份目录
+// @param: name string 配置名
+// @return: string
+func DefaultProfileBackupDir(backupDir, name string) string {
+	return filepath.Join(filepath.Dir(filepath.Clean(backupDir)), filepath.Base(filepath.Clean(backupDir))+"-"+name)
+}
+
+// validateProfiles 检查存档配置是否合法
+func (c Config) validateProfiles() error {
+	seen := map[string]bool{DefaultProfileName: true}
+	for _, p := range c.Profiles {
+		if p.Name == "" {
+			return errors.New("存档配置名不能为空")
+		}
+		if seen[p.Name] {
+			return fmt.Errorf("存档配置名 %s 重复", p.Name)
+		}
+		seen[p.Name] = true
+		if p.BackupDir == "" {
+			return fmt.Errorf("存档配置 %s 的备份目录不能为空", p.Name)
+		}
+		if p.MaxBackups < 0 {
+			return fmt.Errorf("存档配置 %s 的保留数量不能小于0", p.Name)
+		}
+	}
+	if _, ok := c.FindProfile(c.ActiveProfile); !ok {
+		return fmt.Errorf("存档配置 %s 不存在", c.ActiveProfile)
+	}
+	return nil
+}
+
+// @title: SwitchProfile
+// @description: 切换存档配置: 先备份当前存档, 再将目标配置最新的备份安装到其存档目录
+// @param: name string 目标配置名
+// @return: string 切换前的备份名, error
+func SwitchProfile(name string) (string, error) {
+	c := CurrentConfig()
+	target, ok := c.FindProfile(name)
+	if !ok {
+		return "", fmt.Errorf("存档配置 %s 不存在", name)
+	}
+	if name == c.Profile().Name {
+		return "", errors.New("已经是当前存档配置")
+	}
+	if !CanRestore() {
+		return "", errors.New("请先退出关卡再切换存档配置！")
+	}
+
+	backup_name, err := CreateBackup(TriggerSwitch)
+	if err != nil {
+		return "", err
+	}
+
+	// 使用目标配置的全局默认值补全
+	c.ActiveProfile = name
+	target = c.Profile()
+	backups, err := listBackupsIn(target.BackupDir)
+	if err != nil && !os.IsNotExist(err) {
+		return backup_name, err
+	}
+	// 目标配置还没有备份时保留当前存档
+	if len(backups) > 0 {
+		if err := InstallSnapshot(filepath.Join(target.BackupDir, backups[0].Name), target.DataDir); err != nil {
+			return backup_name, err
+		}
+	}
+	return backup_name, UpdateConfig(func(c *Config) { c.ActiveProfile = name })
+}
+
+// @title: InstallSnapshot
+// @description: 用备份完全替换存档目录, 存档目录中备份里没有的文件会被删除
+// @param: backupDir string 备份目录
+// @param: dataDir string 存档目录
+// @return: error
+func InstallSnapshot(backupDir, dataDir string) error {
+	files, err := listFiles(backupDir)
+	if err != nil {
+		return err
+	}
+	defer backup_index.PauseSave()()
+	if IsDir(dataDir) {
+		live, err := listFiles(dataDir)
+		if err != nil {
+			return err
+		}
+		for name := range live {
+			if _, ok := files[name]; !ok {
+				if err := os.Remove(filepath.Join(dataDir, name)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	names := []string{}
+	for name := range files {
+		names = append(names, name)
+	}
+	return RestoreFiles(backupDir, dataDir, names)
+}
+
+// @title: NewProfilesTab
+// @description: 存档配置页
+// @param: w fyne.Window 父窗口
+// @return: fyne.CanvasObject, func(Config) 配置变化时刷新
+func NewProfilesTab(w fyne.Window) (fyne.CanvasObject, func(Config)) {
+	active_label := widget.NewLabel("")
+	active_label.Wrapping = fyne.TextWrapWord
+	profile_select := widget.NewSelect([]string{}, nil)
+
+	refresh := func(c Config) {
+		p := c.Profile()
+		active_label.SetText(fmt.Sprintf("active: %s\ndata: %s\nbackup: %s\nkeep: %d", p.Name, p.DataDir, p.BackupDir, p.MaxBackups))
+		profile_select.SetOptions(c.ProfileNames())
+	}
+	refresh(CurrentConfig())
+
+	switch_button := widget.NewButton("switch", func() {
+		name := profile_select.Selected
+		if name == "" {
+			return
+		}
+		dialog.NewConfirm("Switch profile", "Back up the current save data and switch to "+name+"?", func(ok bool) {
+			if !ok {
+				return
+			}
+			backup_name, err := SwitchProfile(name)
+			if err != nil {
+				dialog.NewInformation("Error", err.Error(), w).Show()
+				return
+			}
+			MakeDir(backup_path)
+			refresh(CurrentConfig())
+			dialog.NewInformation("Success", "Switched to "+name+". Previous data backed up to "+backup_name, w).Show()
+		}, w).Show()
+	})
+
+	name_entry := widget.NewEntry()
+	data_entry := widget.NewEntry()
+	data_entry.SetPlaceHolder("same as settings")
+	backup_entry := widget.NewEntry()
+	max_entry := widget.NewEntry()
+	max_entry.SetPlaceHolder("same as settings")
+	add_button := widget.NewButton("add", func() {
+		max := 0
+		if max_entry.Text != "" {
+			v, err := strconv.Atoi(max_entry.Text)
+			if err != nil {
+				dialog.NewInformation("Error", "Max backups must be a number.", w).Show()
+				return
+			}
+			max = v
+		}
+		backup_dir := backup_entry.Text
+		if backup_dir == "" {
+			backup_dir = DefaultProfileBackupDir(CurrentConfig().BackupDir, name_entry.Text)
+		}
+		err := UpdateConfig(func(c *Config) {
+			c.Profiles = append(c.Profiles, SaveProfile{Name: name_entry.Text, DataDir: data_entry.Text, BackupDir: backup_dir, MaxBackups: max})
+		})
+		if err != nil {
+			dialog.NewInformation("Error", err.Error(), w).Show()
+			return
+		}
+		refresh(CurrentConfig())
+	})
+	remove_button := widget.NewButton("remove", func() {
+		name := profile_select.Selected
+		if name == "" || name == DefaultProfileName || name == CurrentConfig().Profile().Name {
+			dialog.NewInformation("Error", "Cannot remove the default or active profile.", w).Show()
+			return
+		}
+		err := UpdateConfig(func(c *Config) {
+			profiles := []SaveProfile{}
+			for _, p := range c.Profiles {
+				if p.Name != name {
+					profiles = append(profiles, p)
+				}
+			}
+			c.Profiles = profiles
+		})
+		if err != nil {
+			dialog.NewInformation("Error", err.Error(), w).Show()
+			return
+		}
+		refresh(CurrentConfig())
+	})
+
+	return container.NewVScroll(container.NewVBox(
+		active_label,
+		container.NewBorder(nil, nil, nil, container.NewHBox(switch_button, remove_button), profile_select),
+		widget.NewForm(
+			widget.NewFormItem("name", name_entry),
+			widget.NewFormItem("data dir", data_entry),
+			widget.NewFormItem("backup dir", backup_entry),
+			widget.NewFormItem("max backups", max_entry),
+		),
+		add_button,
+	)), refresh
+}
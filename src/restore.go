@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// 备份文件与当前存档的差异状态
+const (
+	FileSame     = "same"      // 与当前存档相同
+	FileChanged  = "changed"   // 与当前存档不同
+	FileNew      = "new"       // 仅存在于备份中
+	FileLiveOnly = "live only" // 仅存在于当前存档中
+)
+
+// @title: BackupFile
+// @description: 备份中的单个文件信息
+type BackupFile struct {
+	// 相对于备份目录的路径
+	Name string
+	// 文件大小
+	Size int64
+	// 修改时间
+	ModTime time.Time
+	// 与当前存档的差异状态
+	Status string
+}
+
+// @title: ListBackupFiles
+// @description: 列出备份中的所有文件, 并与当前存档逐个比较
+// @param: backupDir string 备份目录
+// @param: liveDir string 当前存档目录
+// @return: []BackupFile, error
+func ListBackupFiles(backupDir, liveDir string) ([]BackupFile, error) {
+	files := []BackupFile{}
+	seen := map[string]bool{}
+
+	err := filepath.Walk(backupDir, func(path string, f os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if f.IsDir() {
+			return nil
+		}
+		name, err := filepath.Rel(backupDir, path)
+		if err != nil {
+			return err
+		}
+		if name == backupMetaFile {
+			return nil
+		}
+		seen[name] = true
+
+		status := FileNew
+		if live, err := os.Stat(filepath.Join(liveDir, name)); err == nil {
+			status = FileChanged
+			if live.Size() == f.Size() {
+				same, err := FileEqual(path, filepath.Join(liveDir, name))
+				if err != nil {
+					return err
+				}
+				if same {
+					status = FileSame
+				}
+			}
+		}
+		files = append(files, BackupFile{Name: name, Size: f.Size(), ModTime: f.ModTime(), Status: status})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// 当前存档中有而备份中没有的文件也列出来, 但无法恢复
+	if IsDir(liveDir) {
+		err = filepath.Walk(liveDir, func(path string, f os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if f.IsDir() {
+				return nil
+			}
+			name, err := filepath.Rel(liveDir, path)
+			if err != nil {
+				return err
+			}
+			if !seen[name] {
+				files = append(files, BackupFile{Name: name, Size: f.Size(), ModTime: f.ModTime(), Status: FileLiveOnly})
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Name < files[j].Name
+	})
+	return files, nil
+}
+
+// @title: RestoreFiles
+// @description: 从备份中恢复指定的文件到当前存档目录
+// @param: backupDir string 备份目录
+// @param: liveDir string 当前存档目录
+// @param: names []string 要恢复的文件(相对路径)
+// @return: error
+func RestoreFiles(backupDir, liveDir string, names []string) error {
+	if len(names) == 0 {
+		return errors.New("没有选择要恢复的文件！")
+	}
+	defer backup_index.PauseSave()()
+	for _, name := range names {
+		src := filepath.Join(backupDir, name)
+		des := filepath.Join(liveDir, name)
+		if !FileIsExisted(src) {
+			return fmt.Errorf("备份中不存在文件 %s", name)
+		}
+		if err := MakeDir(filepath.Dir(des)); err != nil {
+			return err
+		}
+		if _, err := CopyFile(src, des); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// @title: FileEqual
+// @description: 判断两个文件内容是否相同
+// @return: bool, error
+func FileEqual(a, b string) (bool, error) {
+	da, err := os.ReadFile(a)
+	if err != nil {
+		return false, err
+	}
+	db, err := os.ReadFile(b)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(da, db), nil
+}
+
+// @title: ShowRestoreFiles
+// @description: 弹出备份文件列表, 选择部分文件进行恢复
+// @param: name string 备份名
+// @param: w fyne.Window 父窗口
+func ShowRestoreFiles(name string, w fyne.Window) {
+	backupDir := BackupDir(name)
+	files, err := ListBackupFiles(backupDir, data_path)
+	if err != nil {
+		dialog.NewInformation("Error", err.Error(), w).Show()
+		return
+	}
+
+	// 选项文本 -> 文件名, 只存在于当前存档的文件只做展示
+	options := []string{}
+	option_files := map[string]string{}
+	// 默认勾选与当前存档不同的文件
+	selected := []string{}
+	for _, f := range files {
+		text := fmt.Sprintf("%s  %s  %s  [%s]", f.Name, FormatSize(f.Size), f.ModTime.Format("2006.01.02 15:04:05"), f.Status)
+		if f.Status != FileLiveOnly && gameSavePattern.MatchString(filepath.Base(f.Name)) {
+			// 关卡存档附带内容预览
+			if save, err := LoadSaveGame(filepath.Join(backupDir, f.Name)); err == nil {
+				text += "  " + save.Summary()
+			}
+		}
+		options = append(options, text)
+		if f.Status != FileLiveOnly {
+			option_files[text] = f.Name
+		}
+		if f.Status == FileChanged || f.Status == FileNew {
+			selected = append(selected, text)
+		}
+	}
+
+	check_group := widget.NewCheckGroup(options, nil)
+	check_group.SetSelected(selected)
+
+	d := dialog.NewCustomConfirm("Restore files - "+name, "Restore", "Cancel", container.NewVScroll(check_group), func(ok bool) {
+		if !ok {
+			return
+		}
+		names := []string{}
+		for _, s := range check_group.Selected {
+			if file, ok := option_files[s]; ok {
+				names = append(names, file)
+			}
+		}
+		err := RestoreFiles(backupDir, data_path, names)
+		if err != nil {
+			dialog.NewInformation("Error", err.Error(), w).Show()
+		} else {
+			dialog.NewInformation("Success", fmt.Sprintf("Restored %d file(s)", len(names)), w).Show()
+		}
+	}, w)
+	d.Resize(fyne.NewSize(560, 400))
+	d.Show()
+}
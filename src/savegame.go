@@ -0,0 +1,282 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// 关卡存档(gameN_M.dat)文件头的魔数
+const saveFileMagic = 0xFEEDDEAD
+
+// 关卡存档的文件名, N为用户ID, M为游戏模式
+var gameSavePattern = regexp.MustCompile(`(?i)^game(\d+)_(\d+)\.dat$`)
+
+// 关卡存档中依次保存的对象数组
+var saveArrays = []struct {
+	stride   int
+	capacity uint32
+}{
+	{zombieSize, 1024},
+	{plantSize, 1024},
+	{projectileSize, 1024},
+	{coinSize, 1024},
+	{lawnMowerSize, 32},
+	{gridItemSize, 128},
+}
+
+// @title: SaveGame
+// @description: 关卡存档, 即游戏保存时(CallSave)写入的棋盘状态
+type SaveGame struct {
+	// 文件头
+	BuildVersion uint32
+	BuildDate    uint32
+	// 正文是否经过压缩
+	Compressed bool
+	// 棋盘状态
+	Board BoardState
+	// 存活的游戏对象
+	Plants      []Plant
+	Zombies     []Zombie
+	Projectiles []Projectile
+	Coins       []Coin
+}
+
+// @title: ParseSaveGame
+// @description: 解析关卡存档
+// @param: data []byte 文件内容
+// @return: *SaveGame, error
+func ParseSaveGame(data []byte) (*SaveGame, error) {
+	if len(data) < 12 || binary.LittleEndian.Uint32(data) != saveFileMagic {
+		return nil, errors.New("不是有效的关卡存档")
+	}
+	s := &SaveGame{
+		BuildVersion: binary.LittleEndian.Uint32(data[4:]),
+		BuildDate:    binary.LittleEndian.Uint32(data[8:]),
+	}
+
+	body := data[12:]
+	start, arrays := findSaveArrays(body)
+	if arrays == nil {
+		// 正文可能经过zlib压缩, 前面可能带有4字节的原始长度
+		for _, skip := range []int{0, 4} {
+			if len(body) <= skip {
+				break
+			}
+			r, err := zlib.NewReader(bytes.NewReader(body[skip:]))
+			if err != nil {
+				continue
+			}
+			inflated, err := io.ReadAll(r)
+			r.Close()
+			if err != nil {
+				continue
+			}
+			if start, arrays = findSaveArrays(inflated); arrays != nil {
+				body = inflated
+				s.Compressed = true
+				break
+			}
+		}
+	}
+	if arrays == nil {
+		return nil, errors.New("无法在关卡存档中找到游戏对象数据")
+	}
+
+	// 对象数组之前为棋盘数据, 保存的是棋盘结构的尾部
+	block := body[:start]
+	if len(block) > boardSize {
+		block = block[len(block)-boardSize:]
+	}
+	board := make([]byte, boardSize)
+	copy(board[boardSize-len(block):], block)
+	s.Board = decodeBoardState(board)
+
+	for _, b := range arrays[0] {
+		if z := decodeZombie(b); !z.Dead {
+			s.Zombies = append(s.Zombies, z)
+		}
+	}
+	for _, b := range arrays[1] {
+		if p := decodePlant(b); !p.Dead {
+			s.Plants = append(s.Plants, p)
+		}
+	}
+	for _, b := range arrays[2] {
+		if p := decodeProjectile(b); !p.Dead {
+			s.Projectiles = append(s.Projectiles, p)
+		}
+	}
+	for _, b := range arrays[3] {
+		if c := decodeCoin(b); !c.Dead {
+			s.Coins = append(s.Coins, c)
+		}
+	}
+	return s, nil
+}
+
+// 对象数组之前至少要有的棋盘数据, 保证能解码出场景、关卡和阳光等字段
+const saveBoardPrefix = boardSize - boardSceneOffset
+
+// findSaveArrays 查找对象数组的起始位置, 返回各数组中在使用的项
+// 要求数组之前有足够的棋盘数据, 所有数组首尾相接且数组头合法, 并且至少有一个数组头不全为0,
+// 否则棋盘数据中连续的0也会被当作六个空数组
+func findSaveArrays(body []byte) (int, [][][]byte) {
+	for start := saveBoardPrefix; start+12 <= len(body); start += 4 {
+		pos := start
+		empty := true
+		arrays := [][][]byte{}
+		for _, a := range saveArrays {
+			if pos+12 > len(body) {
+				break
+			}
+			free := binary.LittleEndian.Uint32(body[pos:])
+			maxUsed := binary.LittleEndian.Uint32(body[pos+4:])
+			count := binary.LittleEndian.Uint32(body[pos+8:])
+			if maxUsed > a.capacity || count > maxUsed || free > a.capacity {
+				break
+			}
+			if free != 0 || maxUsed != 0 {
+				empty = false
+			}
+			pos += 12
+			if pos+int(maxUsed)*a.stride > len(body) {
+				break
+			}
+			items := [][]byte{}
+			for i := 0; i < int(maxUsed); i++ {
+				item := body[pos+i*a.stride : pos+(i+1)*a.stride]
+				if itemAlive(item) {
+					items = append(items, item)
+				}
+			}
+			if len(items) != int(count) {
+				break
+			}
+			arrays = append(arrays, items)
+			pos += int(maxUsed) * a.stride
+		}
+		if len(arrays) == len(saveArrays) && !empty {
+			return start, arrays
+		}
+	}
+	return 0, nil
+}
+
+// @title: LoadSaveGame
+// @description: 读取并解析关卡存档文件
+// @param: path string 文件路径
+// @return: *SaveGame, error
+func LoadSaveGame(path string) (*SaveGame, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseSaveGame(data)
+}
+
+// @title: SaveGame::Summary
+// @description: 关卡存档的简要描述
+// @return: string
+func (s *SaveGame) Summary() string {
+	return fmt.Sprintf("level %d, sun %d, wave %d/%d, %d plants, %d zombies",
+		s.Board.Level, s.Board.Sun, s.Board.Wave, s.Board.TotalWaves, len(s.Plants), len(s.Zombies))
+}
+
+// @title: DescribeSnapshot
+// @description: 描述目录中的所有关卡存档, 用于在恢复前预览
+// @param: dir string 备份或存档目录
+// @return: []string 每个关卡存档一行
+func DescribeSnapshot(dir string) []string {
+	files, err := listFiles(dir)
+	if err != nil {
+		return nil
+	}
+	lines := []string{}
+	for name := range files {
+		m := gameSavePattern.FindStringSubmatch(filepath.Base(name))
+		if m == nil {
+			continue
+		}
+		user, _ := strconv.Atoi(m[1])
+		mode, _ := strconv.Atoi(m[2])
+		s, err := LoadSaveGame(filepath.Join(dir, name))
+		if err != nil {
+			lines = append(lines, fmt.Sprintf("user %d mode %d: %s", user, mode, err.Error()))
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("user %d mode %d: %s", user, mode, s.Summary()))
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+// @title: SnapshotLevel
+// @description: 快照中最近修改的关卡存档所在的关卡, 没有关卡存档时返回0
+// @param: dir string 快照目录
+// @return: int
+func SnapshotLevel(dir string) int {
+	files, err := listFiles(dir)
+	if err != nil {
+		return 0
+	}
+	latest := ""
+	var latest_time int64
+	for name := range files {
+		if !gameSavePattern.MatchString(filepath.Base(name)) {
+			continue
+		}
+		fi, err := os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			continue
+		}
+		if t := fi.ModTime().UnixNano(); latest == "" || t > latest_time {
+			latest, latest_time = name, t
+		}
+	}
+	if latest == "" {
+		return 0
+	}
+	s, err := LoadSaveGame(filepath.Join(dir, latest))
+	if err != nil {
+		return 0
+	}
+	return int(s.Board.Level)
+}
+
+// diffSaveGame 比较两个关卡存档
+func diffSaveGame(s, other *SaveGame) []string {
+	details := []string{}
+	if s.Board.Level != other.Board.Level {
+		details = append(details, fmt.Sprintf("level: %d -> %d", s.Board.Level, other.Board.Level))
+	}
+	if s.Board.Sun != other.Board.Sun {
+		details = append(details, fmt.Sprintf("sun: %d -> %d", s.Board.Sun, other.Board.Sun))
+	}
+	if s.Board.Wave != other.Board.Wave || s.Board.TotalWaves != other.Board.TotalWaves {
+		details = append(details, fmt.Sprintf("wave: %d/%d -> %d/%d", s.Board.Wave, s.Board.TotalWaves, other.Board.Wave, other.Board.TotalWaves))
+	}
+	counts := []struct {
+		name     string
+		old, new int
+	}{
+		{"plants", len(s.Plants), len(other.Plants)},
+		{"zombies", len(s.Zombies), len(other.Zombies)},
+		{"projectiles", len(s.Projectiles), len(other.Projectiles)},
+		{"coins", len(s.Coins), len(other.Coins)},
+	}
+	for _, c := range counts {
+		if c.old != c.new {
+			details = append(details, fmt.Sprintf("%s: %d -> %d", c.name, c.old, c.new))
+		}
+	}
+	return details
+}
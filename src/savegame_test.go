@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// saveArray 关卡存档中的一个对象数组, dead为已消失但仍在数组中的项
+type saveArray struct {
+	stride int
+	items  [][]byte
+	dead   int
+}
+
+// buildSaveBody 按关卡存档的布局生成正文: 棋盘结构的尾部, 然后是首尾相接的对象数组
+func buildSaveBody(board []byte, arrays []saveArray) []byte {
+	var buf bytes.Buffer
+	buf.Write(board)
+	for _, a := range arrays {
+		total := len(a.items) + a.dead
+		head := make([]byte, 12)
+		binary.LittleEndian.PutUint32(head, uint32(total))
+		binary.LittleEndian.PutUint32(head[4:], uint32(total))
+		binary.LittleEndian.PutUint32(head[8:], uint32(len(a.items)))
+		buf.Write(head)
+		for i := 0; i < total; i++ {
+			item := make([]byte, a.stride)
+			if i < len(a.items) {
+				copy(item, a.items[i])
+				// 在使用的项最后4字节为对象ID, 高16位不为0
+				binary.LittleEndian.PutUint32(item[a.stride-4:], uint32(i+1)<<16|uint32(i))
+			}
+			buf.Write(item)
+		}
+	}
+	return buf.Bytes()
+}
+
+func saveFileHeader() []byte {
+	head := make([]byte, 12)
+	binary.LittleEndian.PutUint32(head, saveFileMagic)
+	binary.LittleEndian.PutUint32(head[4:], 1)
+	binary.LittleEndian.PutUint32(head[8:], 20240101)
+	return head
+}
+
+// testSaveBody 第13关, 1个植物和1个僵尸, 棋盘数据开头是一大段0
+func testSaveBody() []byte {
+	// 只保存棋盘结构中从场景字段之前开始的尾部
+	board := make([]byte, boardSize-boardSceneOffset+0x100)
+	base := boardSize - len(board)
+	binary.LittleEndian.PutUint32(board[boardSceneOffset-base:], 1)
+	binary.LittleEndian.PutUint32(board[boardLevelOffset-base:], 13)
+	binary.LittleEndian.PutUint32(board[boardSunOffset-base:], 275)
+	binary.LittleEndian.PutUint32(board[boardWaveOffset-base:], 4)
+	binary.LittleEndian.PutUint32(board[boardTotalWavesOffset-base:], 20)
+
+	plant := make([]byte, plantSize)
+	binary.LittleEndian.PutUint32(plant[0x1C:], 2)
+	binary.LittleEndian.PutUint32(plant[0x24:], 1)
+	binary.LittleEndian.PutUint32(plant[0x28:], 3)
+	zombie := make([]byte, zombieSize)
+	binary.LittleEndian.PutUint32(zombie[0x1C:], 4)
+	binary.LittleEndian.PutUint32(zombie[0x24:], 2)
+	mower := make([]byte, lawnMowerSize)
+
+	return buildSaveBody(board, []saveArray{
+		{stride: zombieSize, items: [][]byte{zombie}, dead: 1},
+		{stride: plantSize, items: [][]byte{plant}},
+		{stride: projectileSize},
+		{stride: coinSize},
+		{stride: lawnMowerSize, items: [][]byte{mower, mower, mower, mower, mower}},
+		{stride: gridItemSize},
+	})
+}
+
+func checkTestSave(t *testing.T, s *SaveGame) {
+	t.Helper()
+	if s.Board.Scene != 1 || s.Board.Level != 13 || s.Board.Sun != 275 || s.Board.Wave != 4 || s.Board.TotalWaves != 20 {
+		t.Fatalf("board = %+v", s.Board)
+	}
+	if len(s.Plants) != 1 || s.Plants[0].Type != 1 || s.Plants[0].Row != 2 || s.Plants[0].Col != 3 {
+		t.Fatalf("plants = %+v", s.Plants)
+	}
+	if len(s.Zombies) != 1 || s.Zombies[0].Type != 2 || s.Zombies[0].Row != 4 {
+		t.Fatalf("zombies = %+v", s.Zombies)
+	}
+}
+
+func TestParseSaveGame(t *testing.T) {
+	s, err := ParseSaveGame(append(saveFileHeader(), testSaveBody()...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Compressed {
+		t.Fatal("Compressed = true")
+	}
+	checkTestSave(t, s)
+}
+
+func TestParseSaveGameCompressed(t *testing.T) {
+	body := testSaveBody()
+	var buf bytes.Buffer
+	size := make([]byte, 4)
+	binary.LittleEndian.PutUint32(size, uint32(len(body)))
+	buf.Write(size)
+	zw := zlib.NewWriter(&buf)
+	zw.Write(body)
+	zw.Close()
+
+	s, err := ParseSaveGame(append(saveFileHeader(), buf.Bytes()...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.Compressed {
+		t.Fatal("Compressed = false")
+	}
+	checkTestSave(t, s)
+}
+
+func TestParseSaveGameRejectsZeros(t *testing.T) {
+	// 全为0的正文不能被当作空的对象数组
+	if _, err := ParseSaveGame(append(saveFileHeader(), make([]byte, 4096)...)); err == nil {
+		t.Fatal("expected error for a body of zeros")
+	}
+}
+
+func TestSnapshotLevelAfterCopy(t *testing.T) {
+	// 第二个存档改为第7关
+	other := testSaveBody()
+	base := boardSize - (boardSize - boardSceneOffset + 0x100)
+	binary.LittleEndian.PutUint32(other[boardLevelOffset-base:], 7)
+
+	data, snapshot := t.TempDir(), t.TempDir()
+	now := time.Now()
+	saves := []struct {
+		name  string
+		body  []byte
+		mtime time.Time
+	}{
+		{"game1_0.dat", other, now},
+		{"game1_1.dat", testSaveBody(), now.Add(-time.Hour)},
+	}
+	for _, s := range saves {
+		path := filepath.Join(data, s.name)
+		if err := os.WriteFile(path, append(saveFileHeader(), s.body...), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, s.mtime, s.mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if level := SnapshotLevel(data); level != 7 {
+		t.Fatalf("存档目录 SnapshotLevel = %d", level)
+	}
+
+	// 按修改时间先后复制, 复制后的修改时间应与原文件相同
+	for _, s := range saves {
+		time.Sleep(10 * time.Millisecond)
+		if _, err := CopyFile(filepath.Join(data, s.name), filepath.Join(snapshot, s.name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if level := SnapshotLevel(snapshot); level != 7 {
+		t.Fatalf("快照 SnapshotLevel = %d", level)
+	}
+}
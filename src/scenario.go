@@ -0,0 +1,268 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+)
+
+// @title: Scenario
+// @description: 场景文件, 描述关卡、阳光和每格的植物与僵尸, 行列从0开始
+type Scenario struct {
+	Name string `json:"name,omitempty"`
+	// 关卡, 为0时不检查
+	Level int32 `json:"level,omitempty"`
+	// 阳光, 为空时不修改
+	Sun *int `json:"sun,omitempty"`
+	// 应用前是否清除已有的植物和僵尸
+	Clear   bool             `json:"clear,omitempty"`
+	Plants  []ScenarioPlant  `json:"plants"`
+	Zombies []ScenarioZombie `json:"zombies"`
+}
+
+// @title: ScenarioPlant
+// @description: 场景中的植物
+type ScenarioPlant struct {
+	Row  int     `json:"row"`
+	Col  int     `json:"col"`
+	Type TypeRef `json:"type"`
+}
+
+// @title: ScenarioZombie
+// @description: 场景中的僵尸, 列为空时在屏幕右侧生成
+type ScenarioZombie struct {
+	Row  int     `json:"row"`
+	Col  *int    `json:"col,omitempty"`
+	Type TypeRef `json:"type"`
+}
+
+// @title: TypeRef
+// @description: 植物或僵尸类型, 在文件中可以写名称或ID
+type TypeRef string
+
+func (t *TypeRef) UnmarshalJSON(data []byte) error {
+	var id int32
+	if err := json.Unmarshal(data, &id); err == nil {
+		*t = TypeRef(strconv.Itoa(int(id)))
+		return nil
+	}
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		return fmt.Errorf("类型必须是名称或ID: %s", string(data))
+	}
+	*t = TypeRef(name)
+	return nil
+}
+
+// MarshalJSON ID输出为数字
+func (t TypeRef) MarshalJSON() ([]byte, error) {
+	if id, err := strconv.Atoi(string(t)); err == nil {
+		return json.Marshal(id)
+	}
+	return json.Marshal(string(t))
+}
+
+// typeRef 名称表中有该类型时使用名称, 否则使用ID
+func typeRef(names map[int32]string, id int32) TypeRef {
+	if name, ok := names[id]; ok {
+		return TypeRef(name)
+	}
+	return TypeRef(strconv.Itoa(int(id)))
+}
+
+// @title: LoadScenario
+// @description: 读取场景文件并检查类型是否存在
+// @param: path string 文件路径
+// @return: *Scenario, error
+func LoadScenario(path string) (*Scenario, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	s := &Scenario{}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("场景文件格式错误: %v", err)
+	}
+	for _, p := range s.Plants {
+		if _, err := ParsePlantType(string(p.Type)); err != nil {
+			return nil, err
+		}
+	}
+	for _, z := range s.Zombies {
+		if _, err := ParseZombieType(string(z.Type)); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// @title: Scenario::Save
+// @description: 保存场景文件
+// @param: path string 文件路径
+// @return: error
+func (s *Scenario) Save(path string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0666)
+}
+
+// @title: ApplyScenario
+// @description: 将场景应用到当前关卡
+// @param: a *Actions
+// @param: s *Scenario 场景
+// @param: force bool 关卡不同时是否仍然应用
+// @return: error
+func ApplyScenario(a *Actions, s *Scenario, force bool) error {
+	board, err := a.board()
+	if err != nil {
+		return err
+	}
+	if s.Level != 0 && s.Level != board.Level && !force {
+		return fmt.Errorf("场景是关卡 %d 的, 当前关卡为 %d", s.Level, board.Level)
+	}
+	// 先检查所有格子和类型, 避免应用到一半失败
+	plant_types := []PlantType{}
+	for _, p := range s.Plants {
+		if err := checkCell(board, p.Row, p.Col); err != nil {
+			return err
+		}
+		t, err := ParsePlantType(string(p.Type))
+		if err != nil {
+			return err
+		}
+		if _, ok := version_profile.Plants[int32(t)]; !ok {
+			return fmt.Errorf("未知的植物 %d, 可以在版本配置文件中补充", int32(t))
+		}
+		plant_types = append(plant_types, t)
+	}
+	zombie_types := []ZombieType{}
+	for _, z := range s.Zombies {
+		if err := checkCell(board, z.Row, 0); err != nil {
+			return err
+		}
+		t, err := ParseZombieType(string(z.Type))
+		if err != nil {
+			return err
+		}
+		if _, ok := version_profile.Zombies[int32(t)]; !ok {
+			return fmt.Errorf("未知的僵尸 %d, 可以在版本配置文件中补充", int32(t))
+		}
+		zombie_types = append(zombie_types, t)
+		if z.Col != nil && (*z.Col < 0 || *z.Col > boardCols) {
+			return fmt.Errorf("列 %d 超出范围 0-%d", *z.Col, boardCols)
+		}
+	}
+
+	if s.Clear {
+		if _, err := a.ClearPlants(); err != nil {
+			return err
+		}
+		if _, err := a.ClearZombies(); err != nil {
+			return err
+		}
+	}
+	if s.Sun != nil {
+		if err := SetSun(a.memory, *s.Sun); err != nil {
+			return err
+		}
+	}
+	for i, p := range s.Plants {
+		if err := a.PlacePlant(p.Row, p.Col, plant_types[i]); err != nil {
+			return err
+		}
+	}
+	for i, z := range s.Zombies {
+		col := boardCols
+		if z.Col != nil {
+			col = *z.Col
+		}
+		if err := a.SpawnZombie(z.Row, col, zombie_types[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// @title: ExportScenario
+// @description: 从当前关卡导出场景
+// @param: m Memory 游戏内存
+// @return: *Scenario, error
+func ExportScenario(m Memory) (*Scenario, error) {
+	board, err := ReadBoard(m)
+	if err != nil {
+		return nil, err
+	}
+	entities, err := ReadEntities(m)
+	if err != nil {
+		return nil, err
+	}
+	sun := int(board.Sun)
+	s := &Scenario{Level: board.Level, Sun: &sun, Clear: true, Plants: []ScenarioPlant{}, Zombies: []ScenarioZombie{}}
+	for _, p := range entities.Plants {
+		s.Plants = append(s.Plants, ScenarioPlant{Row: int(p.Row), Col: int(p.Col), Type: typeRef(version_profile.Plants, int32(p.Type))})
+	}
+	for _, z := range entities.Zombies {
+		col := zombieCol(z.X)
+		s.Zombies = append(s.Zombies, ScenarioZombie{Row: int(z.Row), Col: &col, Type: typeRef(version_profile.Zombies, int32(z.Type))})
+	}
+	return s, nil
+}
+
+// zombieCol 僵尸所在的列, 每列宽80像素, 第一列从40开始
+func zombieCol(x float32) int {
+	col := int((x - 40) / 80)
+	if col < 0 {
+		return 0
+	}
+	if col > boardCols {
+		return boardCols
+	}
+	return col
+}
+
+// @title: ShowLoadScenario
+// @description: 选择场景文件并应用到当前关卡
+// @param: w fyne.Window 父窗口
+func ShowLoadScenario(w fyne.Window) {
+	dialog.NewFileOpen(func(r fyne.URIReadCloser, err error) {
+		if err != nil || r == nil {
+			return
+		}
+		r.Close()
+		s, err := LoadScenario(r.URI().Path())
+		if err == nil {
+			err = ApplyScenario(NewActions(), s, false)
+		}
+		if err != nil {
+			dialog.NewInformation("Error", err.Error(), w).Show()
+		}
+	}, w).Show()
+}
+
+// @title: ShowExportScenario
+// @description: 将当前关卡导出为场景文件
+// @param: w fyne.Window 父窗口
+func ShowExportScenario(w fyne.Window) {
+	s, err := ExportScenario(pvz)
+	if err != nil {
+		dialog.NewInformation("Error", err.Error(), w).Show()
+		return
+	}
+	d := dialog.NewFileSave(func(wc fyne.URIWriteCloser, err error) {
+		if err != nil || wc == nil {
+			return
+		}
+		wc.Close()
+		if err := s.Save(wc.URI().Path()); err != nil {
+			dialog.NewInformation("Error", err.Error(), w).Show()
+		}
+	}, w)
+	d.SetFileName(fmt.Sprintf("level%d.json", s.Level))
+	d.Show()
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseTypeIDs(t *testing.T) {
+	for s, want := range map[string]PlantType{"Sunflower": 1, "sunflower": 1, "1": 1, "200": 200, "plant#200": 200} {
+		if got, err := ParsePlantType(s); err != nil || got != want {
+			t.Errorf("ParsePlantType(%q) = %d, %v, want %d", s, got, err, want)
+		}
+	}
+	for _, s := range []string{"", "-1", "Sunflowers", "zombie#3"} {
+		if _, err := ParsePlantType(s); err == nil {
+			t.Errorf("ParsePlantType(%q) succeeded", s)
+		}
+	}
+	if got, err := ParseZombieType(ZombieType(77).String()); err != nil || got != 77 {
+		t.Errorf("ParseZombieType(%q) = %d, %v", ZombieType(77).String(), got, err)
+	}
+}
+
+func TestExportScenarioRoundTrip(t *testing.T) {
+	g := newTestGame()
+	binary.LittleEndian.PutUint32(g.board[boardLevelOffset:], 12)
+	binary.LittleEndian.PutUint32(g.board[boardSunOffset:], 300)
+	g.addPlant(1, 0, 2, false)
+	g.addPlant(200, 1, 4, false) // 名称表中没有的植物
+	g.add(boardZombiesOffset, zombieSize, func(item []byte) {
+		binary.LittleEndian.PutUint32(item[0x1C:], 3)
+		binary.LittleEndian.PutUint32(item[0x24:], 2)
+		binary.LittleEndian.PutUint32(item[0x2C:], math.Float32bits(40+80*5))
+	})
+
+	s, err := ExportScenario(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := json.Marshal(s)
+	if !strings.Contains(string(data), `"type":200`) || !strings.Contains(string(data), `"type":"Sunflower"`) {
+		t.Fatalf("exported = %s", data)
+	}
+
+	path := filepath.Join(t.TempDir(), "scenario.json")
+	if err := s.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadScenario(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Level != 12 || *loaded.Sun != 300 || len(loaded.Plants) != 2 || len(loaded.Zombies) != 1 || *loaded.Zombies[0].Col != 5 {
+		t.Fatalf("loaded = %+v", loaded)
+	}
+	if id, err := ParsePlantType(string(loaded.Plants[1].Type)); err != nil || id != 200 {
+		t.Fatalf("plant type = %q", loaded.Plants[1].Type)
+	}
+
+	// 名称表中没有的类型不能种植, 在修改关卡之前报错
+	a, calls := newTestActions(g)
+	if err := ApplyScenario(a, loaded, false); err == nil || len(*calls) != 0 {
+		t.Fatalf("ApplyScenario = %v, %d calls", err, len(*calls))
+	}
+	loaded.Plants = loaded.Plants[:1]
+	if err := ApplyScenario(a, loaded, false); err != nil {
+		t.Fatal(err)
+	}
+	// 清除植物和僵尸, 然后种植1个植物、生成1个僵尸
+	if len(*calls) != 4 {
+		t.Fatalf("calls = %d", len(*calls))
+	}
+}
@@ -0,0 +1,474 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"go.starlark.net/resolve"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+	"go.starlark.net/syntax"
+)
+
+// 自动化规则脚本使用Starlark编写, 用 on(事件, 函数) 注册规则, 事件发生时以 (event, game) 调用函数:
+//
+//	# 第10波开始时备份
+//	def wave_backup(event, game):
+//	    if event.wave == 10:
+//	        backup("wave 10")
+//	on("wave_started", wave_backup)
+//
+//	# 黑夜关卡(黑夜, 浓雾, 月夜)播放第5首音乐
+//	def night_music(event, game):
+//	    if event.scene in (SCENE_NIGHT, SCENE_FOG, SCENE_MOON_NIGHT):
+//	        play(5)
+//	on("level_started", night_music)
+//
+// event 是事件数据, event.type 为事件名; game 是事件发生时的游戏状态(running, ui, music, level, scene, sun, wave, ...)
+// 函数: backup([名称]), play(音乐ID或名称), stop(), notify(标题[, 内容]), print(值...),
+// read(地址, 偏移...) 读取内存, plant(ID), zombie(ID), music_name(ID) 名称,
+// getvar(名称[, 默认值]), setvar(名称, 值) 读写在多次执行之间保留的变量
+
+// 单次执行最多计算的步数
+const scriptMaxSteps = 100000
+
+// 单次执行最多产生的动作数
+const scriptMaxActions = 16
+
+// 单次执行的时间限制
+const scriptTimeout = 200 * time.Millisecond
+
+// 报错时使用的脚本文件名
+const scriptFileName = "script"
+
+// 线程局部变量的键
+const (
+	scriptLocalScript = "script"
+	scriptLocalRun    = "run"
+)
+
+// @title: Script
+// @description: 加载后的规则脚本
+type Script struct {
+	Rules []*ScriptRule
+}
+
+// @title: ScriptRule
+// @description: 一条规则
+type ScriptRule struct {
+	// 触发的事件
+	Event string
+	// 规则函数, 以 (event, game) 调用
+	Func *starlark.Function
+	// 函数定义所在的行, 用于报错
+	Line int
+}
+
+// @title: ScriptAction
+// @description: 规则执行后产生的动作, 由ScriptHost执行
+type ScriptAction struct {
+	// backup, play, stop, notify, log
+	Type    string
+	Text    string
+	Content string
+	Music   MusicID
+}
+
+// @title: ScriptHost
+// @description: 脚本能访问的游戏和备份功能, 脚本只能通过它读取内存和执行动作
+type ScriptHost interface {
+	// 读取游戏状态, 每个事件只读取一次
+	State() map[string]interface{}
+	// 读取内存中的4字节整数
+	ReadInt32(address ...int) (int32, error)
+	// 执行动作
+	Do(action ScriptAction) error
+}
+
+// scriptRun 一条规则一次执行的状态
+type scriptRun struct {
+	host    ScriptHost
+	vars    map[string]interface{}
+	actions []ScriptAction
+}
+
+// add 记录动作, 超过数量限制时返回错误
+func (r *scriptRun) add(action ScriptAction) error {
+	if len(r.actions) >= scriptMaxActions {
+		return errors.New("产生的动作数量超过限制")
+	}
+	r.actions = append(r.actions, action)
+	return nil
+}
+
+// call 在新的线程中调用规则函数, 超过步数或时间限制时中止
+func (r *scriptRun) call(fn *starlark.Function, args ...starlark.Value) error {
+	thread, stop := newScriptThread(fn.Name())
+	defer stop()
+	thread.SetLocal(scriptLocalRun, r)
+	thread.Print = func(thread *starlark.Thread, msg string) {
+		if err := r.add(ScriptAction{Type: "log", Text: msg}); err != nil {
+			thread.Cancel(err.Error())
+		}
+	}
+	_, err := starlark.Call(thread, fn, args, nil)
+	return scriptError(err)
+}
+
+// newScriptThread 创建有步数和时间限制的线程, 返回的函数用于停止计时
+func newScriptThread(name string) (*starlark.Thread, func()) {
+	thread := &starlark.Thread{Name: name}
+	thread.SetMaxExecutionSteps(scriptMaxSteps)
+	thread.OnMaxSteps = func(thread *starlark.Thread) {
+		thread.Cancel("脚本执行步数超过限制")
+	}
+	timer := time.AfterFunc(scriptTimeout, func() {
+		thread.Cancel("脚本执行超时")
+	})
+	return thread, func() { timer.Stop() }
+}
+
+// scriptError 将Starlark的错误转换为带行号的错误
+func scriptError(err error) error {
+	var eval_err *starlark.EvalError
+	var syntax_err syntax.Error
+	var resolve_errs resolve.ErrorList
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, &eval_err):
+		// 使用脚本中最内层的调用位置
+		for i := len(eval_err.CallStack) - 1; i >= 0; i-- {
+			if pos := eval_err.CallStack[i].Pos; pos.Filename() == scriptFileName {
+				return fmt.Errorf("第%d行: %s", pos.Line, eval_err.Msg)
+			}
+		}
+		return errors.New(eval_err.Msg)
+	case errors.As(err, &syntax_err):
+		return fmt.Errorf("第%d行: %s", syntax_err.Pos.Line, syntax_err.Msg)
+	case errors.As(err, &resolve_errs) && len(resolve_errs) > 0:
+		return fmt.Errorf("第%d行: %s", resolve_errs[0].Pos.Line, resolve_errs[0].Msg)
+	}
+	return err
+}
+
+// @title: ParseScript
+// @description: 执行脚本的顶层代码, 收集用on注册的规则
+// @param: src string 脚本内容
+// @return: *Script, error
+func ParseScript(src string) (*Script, error) {
+	s := &Script{}
+	thread, stop := newScriptThread(scriptFileName)
+	defer stop()
+	thread.SetLocal(scriptLocalScript, s)
+	if _, err := starlark.ExecFile(thread, scriptFileName, src, scriptPredeclared); err != nil {
+		return nil, scriptError(err)
+	}
+	return s, nil
+}
+
+// @title: Script::Run
+// @description: 对事件执行所有匹配的规则, 返回产生的动作, 某条规则出错时跳过该规则
+// @param: host ScriptHost 游戏和备份功能
+// @param: e GameEvent 事件
+// @param: globals map[string]interface{} setvar设置的变量, 在多次执行之间保留
+// @return: []ScriptAction, []error 每条出错的规则一个错误
+func (s *Script) Run(host ScriptHost, e GameEvent, globals map[string]interface{}) ([]ScriptAction, []error) {
+	actions := []ScriptAction{}
+	errs := []error{}
+	var event, game starlark.Value
+	for _, rule := range s.Rules {
+		if rule.Event != e.Type {
+			continue
+		}
+		if event == nil {
+			// 所有规则共用同一次读取的游戏状态
+			event, game = scriptEventValue(e), scriptStateValue(host)
+		}
+		// 规则出错时不修改变量
+		r := &scriptRun{host: host, vars: map[string]interface{}{}}
+		for k, v := range globals {
+			r.vars[k] = v
+		}
+		if err := r.call(rule.Func, event, game); err != nil {
+			errs = append(errs, fmt.Errorf("第%d行的规则: %v", rule.Line, err))
+			continue
+		}
+		for k, v := range r.vars {
+			globals[k] = v
+		}
+		actions = append(actions, r.actions...)
+	}
+	return actions, errs
+}
+
+// scriptEventValue 事件数据, 字段为事件数据和事件名type
+func scriptEventValue(e GameEvent) starlark.Value {
+	fields := starlark.StringDict{}
+	for k, v := range e.Data {
+		fields[k] = toScriptValue(v)
+	}
+	fields["type"] = starlark.String(e.Type)
+	return starlarkstruct.FromStringDict(starlarkstruct.Default, fields)
+}
+
+// scriptStateValue 游戏状态, 没有host时为空
+func scriptStateValue(host ScriptHost) starlark.Value {
+	fields := starlark.StringDict{}
+	if host != nil {
+		for k, v := range host.State() {
+			fields[k] = toScriptValue(v)
+		}
+	}
+	return starlarkstruct.FromStringDict(starlarkstruct.Default, fields)
+}
+
+// toScriptValue 将事件数据和游戏状态转换为脚本中的值
+func toScriptValue(v interface{}) starlark.Value {
+	switch v := v.(type) {
+	case nil:
+		return starlark.None
+	case string:
+		return starlark.String(v)
+	case bool:
+		return starlark.Bool(v)
+	case GameUI:
+		return starlark.String(v.String())
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return starlark.MakeInt64(rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return starlark.MakeUint64(rv.Uint())
+	case reflect.Float32, reflect.Float64:
+		return starlark.Float(rv.Float())
+	case reflect.String:
+		return starlark.String(rv.String())
+	case reflect.Bool:
+		return starlark.Bool(rv.Bool())
+	}
+	return starlark.String(fmt.Sprint(v))
+}
+
+// fromScriptValue 将setvar的值转换为Go的值, 只能保存None, 整数, 字符串和布尔值
+func fromScriptValue(v starlark.Value) (interface{}, error) {
+	switch v := v.(type) {
+	case starlark.NoneType:
+		return nil, nil
+	case starlark.Int:
+		n, ok := v.Int64()
+		if !ok {
+			return nil, errors.New("整数超出范围")
+		}
+		return n, nil
+	case starlark.String:
+		return string(v), nil
+	case starlark.Bool:
+		return bool(v), nil
+	}
+	return nil, fmt.Errorf("不能保存 %s 类型的值", v.Type())
+}
+
+// ---- 内置函数 ----
+
+// 脚本中预先定义的函数和常量
+var scriptPredeclared = newScriptPredeclared()
+
+func newScriptPredeclared() starlark.StringDict {
+	predeclared := starlark.StringDict{
+		"on":         starlark.NewBuiltin("on", scriptOn),
+		"backup":     starlark.NewBuiltin("backup", scriptBackup),
+		"play":       starlark.NewBuiltin("play", scriptPlay),
+		"stop":       starlark.NewBuiltin("stop", scriptStop),
+		"notify":     starlark.NewBuiltin("notify", scriptNotify),
+		"read":       starlark.NewBuiltin("read", scriptRead),
+		"plant":      scriptNameFunc("plant", func(n int) string { return PlantType(n).String() }),
+		"zombie":     scriptNameFunc("zombie", func(n int) string { return ZombieType(n).String() }),
+		"music_name": scriptNameFunc("music_name", func(n int) string { return MusicID(n).String() }),
+		"getvar":     starlark.NewBuiltin("getvar", scriptGetVar),
+		"setvar":     starlark.NewBuiltin("setvar", scriptSetVar),
+	}
+	// 场景常量, 如 SCENE_NIGHT, SCENE_MOON_NIGHT
+	for scene, name := range sceneNames {
+		predeclared["SCENE_"+strings.ToUpper(strings.ReplaceAll(name, " ", "_"))] = starlark.MakeInt(int(scene))
+	}
+	return predeclared
+}
+
+// currentScriptRun 正在执行的规则, 不在规则中时返回错误
+func currentScriptRun(thread *starlark.Thread, b *starlark.Builtin) (*scriptRun, error) {
+	r, ok := thread.Local(scriptLocalRun).(*scriptRun)
+	if !ok {
+		return nil, fmt.Errorf("%s 只能在规则中调用", b.Name())
+	}
+	return r, nil
+}
+
+// scriptOn on(事件, 函数) 注册规则, 只能在脚本顶层调用
+func scriptOn(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var event string
+	var fn *starlark.Function
+	if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 2, &event, &fn); err != nil {
+		return nil, err
+	}
+	s, ok := thread.Local(scriptLocalScript).(*Script)
+	if !ok {
+		return nil, errors.New("on 只能在脚本顶层调用")
+	}
+	if !isScriptEvent(event) {
+		return nil, fmt.Errorf("未知的事件 %s", event)
+	}
+	if fn.NumParams() != 2 {
+		return nil, fmt.Errorf("规则函数 %s 需要两个参数 (event, game)", fn.Name())
+	}
+	s.Rules = append(s.Rules, &ScriptRule{Event: event, Func: fn, Line: int(fn.Position().Line)})
+	return starlark.None, nil
+}
+
+// scriptBackup backup([名称]) 保存游戏并备份
+func scriptBackup(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var name string
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "name?", &name); err != nil {
+		return nil, err
+	}
+	r, err := currentScriptRun(thread, b)
+	if err != nil {
+		return nil, err
+	}
+	return starlark.None, r.add(ScriptAction{Type: "backup", Text: name})
+}
+
+// scriptPlay play(音乐ID或名称) 播放音乐
+func scriptPlay(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var music starlark.Value
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "music", &music); err != nil {
+		return nil, err
+	}
+	text := music.String()
+	if s, ok := music.(starlark.String); ok {
+		text = string(s)
+	}
+	id, err := ParseMusic(text)
+	if err != nil {
+		return nil, err
+	}
+	r, err := currentScriptRun(thread, b)
+	if err != nil {
+		return nil, err
+	}
+	return starlark.None, r.add(ScriptAction{Type: "play", Music: id})
+}
+
+// scriptStop stop() 停止音乐
+func scriptStop(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs); err != nil {
+		return nil, err
+	}
+	r, err := currentScriptRun(thread, b)
+	if err != nil {
+		return nil, err
+	}
+	return starlark.None, r.add(ScriptAction{Type: "stop"})
+}
+
+// scriptNotify notify(标题[, 内容]) 发送桌面通知
+func scriptNotify(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var title, content string
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "title", &title, "content?", &content); err != nil {
+		return nil, err
+	}
+	r, err := currentScriptRun(thread, b)
+	if err != nil {
+		return nil, err
+	}
+	return starlark.None, r.add(ScriptAction{Type: "notify", Text: title, Content: content})
+}
+
+// scriptRead read(地址, 偏移...) 按指针链读取4字节整数
+func scriptRead(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if len(args) == 0 || len(kwargs) != 0 {
+		return nil, errors.New("read 至少需要一个地址, 且不接受关键字参数")
+	}
+	address := []int{}
+	for _, arg := range args {
+		n, err := starlark.AsInt32(arg)
+		if err != nil {
+			return nil, fmt.Errorf("read 的参数必须是数字: %v", err)
+		}
+		address = append(address, n)
+	}
+	r, err := currentScriptRun(thread, b)
+	if err != nil {
+		return nil, err
+	}
+	if r.host == nil {
+		return nil, errors.New("无法读取内存")
+	}
+	v, err := r.host.ReadInt32(address...)
+	if err != nil {
+		return nil, err
+	}
+	return starlark.MakeInt(int(v)), nil
+}
+
+// scriptNameFunc 将ID转换为名称的函数
+func scriptNameFunc(name string, f func(n int) string) *starlark.Builtin {
+	return starlark.NewBuiltin(name, func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var n int
+		if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 1, &n); err != nil {
+			return nil, err
+		}
+		return starlark.String(f(n)), nil
+	})
+}
+
+// scriptGetVar getvar(名称[, 默认值]) 读取setvar设置的变量
+func scriptGetVar(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var name string
+	var default_value starlark.Value = starlark.None
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "name", &name, "default?", &default_value); err != nil {
+		return nil, err
+	}
+	r, err := currentScriptRun(thread, b)
+	if err != nil {
+		return nil, err
+	}
+	if v, ok := r.vars[name]; ok {
+		return toScriptValue(v), nil
+	}
+	return default_value, nil
+}
+
+// scriptSetVar setvar(名称, 值) 设置变量, 变量在多次执行之间保留
+func scriptSetVar(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var name string
+	var value starlark.Value
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "name", &name, "value", &value); err != nil {
+		return nil, err
+	}
+	r, err := currentScriptRun(thread, b)
+	if err != nil {
+		return nil, err
+	}
+	v, err := fromScriptValue(value)
+	if err != nil {
+		return nil, err
+	}
+	r.vars[name] = v
+	return starlark.None, nil
+}
+
+// isScriptEvent 是否是能触发规则的事件
+func isScriptEvent(name string) bool {
+	switch name {
+	case EventGameStarted, EventGameExited, EventUIChanged, EventLevelStarted, EventLevelCompleted,
+		EventLevelFailed, EventLevelExited, EventWaveStarted, EventMusicChanged,
+		EventBackup, EventBackupFailed, EventRestore, EventRestoreFailed:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// scriptTestHost 不连接游戏的ScriptHost
+type scriptTestHost struct {
+	state  map[string]interface{}
+	memory map[int]int32
+	// 读取游戏状态的次数
+	reads int
+	// 每次读取内存的耗时, 用于测试超时
+	delay time.Duration
+}
+
+func (h *scriptTestHost) State() map[string]interface{} {
+	h.reads++
+	return h.state
+}
+
+func (h *scriptTestHost) ReadInt32(address ...int) (int32, error) {
+	time.Sleep(h.delay)
+	sum := 0
+	for _, a := range address {
+		sum += a
+	}
+	v, ok := h.memory[sum]
+	if !ok {
+		return 0, errors.New("地址无效")
+	}
+	return v, nil
+}
+
+func (h *scriptTestHost) Do(action ScriptAction) error {
+	return nil
+}
+
+func mustParseScript(t *testing.T, src string) *Script {
+	t.Helper()
+	s, err := ParseScript(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestParseScript(t *testing.T) {
+	s := mustParseScript(t, `
+# 第10波开始时备份
+def wave_backup(event, game):
+    if event.wave == 10:
+        backup("wave 10")
+on("wave_started", wave_backup)
+
+def night_music(event, game):
+    if event.scene in (SCENE_NIGHT, SCENE_FOG, SCENE_MOON_NIGHT):
+        play(5)
+on("level_started", night_music)
+on("game_exited", lambda event, game: None)
+`)
+	if len(s.Rules) != 3 {
+		t.Fatalf("rules = %d", len(s.Rules))
+	}
+	for i, want := range []struct {
+		event string
+		line  int
+	}{
+		{EventWaveStarted, 3},
+		{EventLevelStarted, 8},
+		{EventGameExited, 12},
+	} {
+		if rule := s.Rules[i]; rule.Event != want.event || rule.Line != want.line {
+			t.Errorf("rule %d = %s line %d", i, rule.Event, rule.Line)
+		}
+	}
+
+	// 黑夜, 浓雾和月夜都播放音乐
+	for scene, want := range map[Scene]int{SceneDay: 0, SceneNight: 1, ScenePool: 0, SceneFog: 1, SceneRoof: 0, SceneMoonNight: 1} {
+		actions, errs := s.Run(nil, NewGameEvent(EventLevelStarted, map[string]interface{}{"scene": int32(scene)}), map[string]interface{}{})
+		if len(errs) != 0 || len(actions) != want {
+			t.Errorf("scene %s: actions = %+v, errs = %v", scene, actions, errs)
+		}
+	}
+}
+
+func TestParseScriptErrors(t *testing.T) {
+	for src, want := range map[string]string{
+		`on("lunch", lambda event, game: None)`: "未知的事件 lunch",
+		`on("backup", lambda event: None)`:      "需要两个参数",
+		`on("backup", 1)`:                       "on: for parameter 2",
+		`backup("now")`:                         "backup 只能在规则中调用",
+		`on("backup", lambda event, game: None`: "第1行",
+		`x = y`:                                 "undefined: y",
+		"while True:\n    pass":                 "while",
+		"x = 1\n\nplay(\"nothing\")":            "第3行",
+		"def f():\n    return f()\nf()":         "recursively",
+		"x = [i for i in range(1000000000)]":    "步数超过限制",
+	} {
+		_, err := ParseScript(src)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("ParseScript(%q) = %v, want error containing %q", src, err, want)
+		}
+	}
+}
+
+func TestScriptRun(t *testing.T) {
+	s := mustParseScript(t, `
+def half(event, game):
+    if event.wave == event.total_waves // 2 and not game.sun < 100:
+        backup("half %d" % event.wave)
+        print("sun", game.sun, read(0x6A9EC0, 0x768))
+on("wave_started", half)
+
+on("wave_started", lambda event, game: stop() if event.wave > 1000 else None)
+
+def count_levels(event, game):
+    setvar("count", getvar("count", 0) + 1)
+    notify("level %d" % event.level, plant(1))
+on("level_started", count_levels)
+
+def second_level(event, game):
+    if getvar("count") >= 2:
+        play(5)
+on("level_started", second_level)
+
+def exited(event, game):
+    print(event.level)
+on("level_exited", exited)
+`)
+	host := &scriptTestHost{
+		state:  map[string]interface{}{"sun": int32(150), "ui": GameUIPlaying},
+		memory: map[int]int32{0x6A9EC0 + 0x768: 42},
+	}
+	globals := map[string]interface{}{}
+
+	actions, errs := s.Run(host, NewGameEvent(EventWaveStarted, map[string]interface{}{"wave": int32(10), "total_waves": int32(20)}), globals)
+	want := []ScriptAction{
+		{Type: "backup", Text: "half 10"},
+		{Type: "log", Text: "sun 150 42"},
+	}
+	if len(errs) != 0 || !reflect.DeepEqual(actions, want) {
+		t.Fatalf("wave_started = %+v %v", actions, errs)
+	}
+
+	// 变量在多次执行之间保留, 同一事件的后续规则能读到前面的规则设置的值
+	level := NewGameEvent(EventLevelStarted, map[string]interface{}{"level": 5})
+	if actions, errs = s.Run(host, level, globals); len(errs) != 0 || len(actions) != 1 || actions[0].Text != "level 5" || actions[0].Content != PlantType(1).String() {
+		t.Fatalf("first level_started = %+v %v", actions, errs)
+	}
+	if actions, errs = s.Run(host, level, globals); len(errs) != 0 || len(actions) != 2 || actions[1].Type != "play" || actions[1].Music != 5 {
+		t.Fatalf("second level_started = %+v %v", actions, errs)
+	}
+	if globals["count"] != int64(2) {
+		t.Fatalf("count = %v", globals["count"])
+	}
+
+	// 出错的规则不产生动作, 其他规则照常执行
+	actions, errs = s.Run(host, NewGameEvent(EventLevelExited, nil), globals)
+	if len(actions) != 0 || len(errs) != 1 || !strings.Contains(errs[0].Error(), "no .level attribute") || !strings.Contains(errs[0].Error(), "第21行") {
+		t.Fatalf("level_exited = %+v %v", actions, errs)
+	}
+}
+
+func TestScriptStateReadOnce(t *testing.T) {
+	s := mustParseScript(t, `
+def first(event, game):
+    print(game.sun, game.sun, game.ui)
+on("backup", first)
+on("backup", lambda event, game: print(game.sun + 1))
+`)
+	host := &scriptTestHost{state: map[string]interface{}{"sun": 50, "ui": GameUIPlaying}}
+	actions, errs := s.Run(host, NewGameEvent(EventBackup, nil), map[string]interface{}{})
+	want := []ScriptAction{{Type: "log", Text: "50 50 playing"}, {Type: "log", Text: "51"}}
+	if len(errs) != 0 || !reflect.DeepEqual(actions, want) {
+		t.Fatalf("actions = %+v %v", actions, errs)
+	}
+	if host.reads != 1 {
+		t.Fatalf("state read %d times for one event", host.reads)
+	}
+	// 没有规则的事件不读取游戏状态
+	s.Run(host, NewGameEvent(EventRestore, nil), map[string]interface{}{})
+	if host.reads != 1 {
+		t.Fatalf("state read for an event without rules")
+	}
+}
+
+func TestScriptErrorKeepsGlobals(t *testing.T) {
+	s := mustParseScript(t, `
+def f(event, game):
+    setvar("x", 1)
+    print(1 // getvar("zero"))
+on("backup", f)
+`)
+	globals := map[string]interface{}{"x": int64(0), "zero": int64(0)}
+	_, errs := s.Run(nil, NewGameEvent(EventBackup, nil), globals)
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "by zero") || !strings.Contains(errs[0].Error(), "第4行") {
+		t.Fatalf("errs = %v", errs)
+	}
+	if globals["x"] != int64(0) {
+		t.Fatalf("x = %v, the failed rule changed it", globals["x"])
+	}
+}
+
+func TestScriptSetVar(t *testing.T) {
+	s := mustParseScript(t, `
+def f(event, game):
+    setvar("n", 7)
+    setvar("s", "text")
+    setvar("b", True)
+    setvar("none", None)
+    if event.name == "bad":
+        setvar("list", [1])
+on("backup", f)
+`)
+	globals := map[string]interface{}{}
+	if _, errs := s.Run(nil, NewGameEvent(EventBackup, map[string]interface{}{"name": "ok"}), globals); len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	want := map[string]interface{}{"n": int64(7), "s": "text", "b": true, "none": nil}
+	if !reflect.DeepEqual(globals, want) {
+		t.Fatalf("globals = %#v", globals)
+	}
+	_, errs := s.Run(nil, NewGameEvent(EventBackup, map[string]interface{}{"name": "bad"}), globals)
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "不能保存 list") {
+		t.Fatalf("errs = %v", errs)
+	}
+}
+
+func TestScriptStepLimit(t *testing.T) {
+	s := mustParseScript(t, `
+def f(event, game):
+    setvar("x", 1)
+    for i in range(1000000000):
+        pass
+on("backup", f)
+`)
+	globals := map[string]interface{}{}
+	_, errs := s.Run(nil, NewGameEvent(EventBackup, nil), globals)
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "步数超过限制") {
+		t.Fatalf("errs = %v", errs)
+	}
+	if _, ok := globals["x"]; ok {
+		t.Fatal("x was set by a rule over the step limit")
+	}
+}
+
+func TestScriptTimeout(t *testing.T) {
+	s := mustParseScript(t, `
+def f(event, game):
+    for i in range(1000):
+        read(0)
+on("backup", f)
+`)
+	host := &scriptTestHost{memory: map[int]int32{0: 1}, delay: 5 * time.Millisecond}
+	start := time.Now()
+	_, errs := s.Run(host, NewGameEvent(EventBackup, nil), map[string]interface{}{})
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "超时") {
+		t.Fatalf("errs = %v", errs)
+	}
+	// 超时后最多再完成一次正在进行的读取
+	if elapsed := time.Since(start); elapsed > scriptTimeout+10*host.delay {
+		t.Fatalf("elapsed = %v", elapsed)
+	}
+}
+
+func TestScriptActionLimit(t *testing.T) {
+	for _, body := range []string{"print(i)", "backup()"} {
+		s := mustParseScript(t, "def f(event, game):\n    for i in range(100):\n        "+body+"\non(\"backup\", f)")
+		actions, errs := s.Run(nil, NewGameEvent(EventBackup, nil), map[string]interface{}{})
+		if len(actions) != 0 || len(errs) != 1 || !strings.Contains(errs[0].Error(), "动作数量超过限制") {
+			t.Fatalf("%s: actions = %d, errs = %v", body, len(actions), errs)
+		}
+	}
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 本地API默认监听的地址
+const DefaultAPIAddress = "127.0.0.1:8723"
+
+// SSE保持连接的间隔
+const apiKeepAliveInterval = 15 * time.Second
+
+// @title: APISettings
+// @description: 本地HTTP API设置
+type APISettings struct {
+	// 是否启用
+	Enabled bool `json:"enabled"`
+	// 监听地址, 只能是本机地址
+	Address string `json:"address"`
+	// 访问令牌
+	Token string `json:"token"`
+}
+
+// @title: APISettings::Validate
+// @description: 检查API设置是否合法
+// @return: error
+func (s APISettings) Validate() error {
+	if !s.Enabled {
+		return nil
+	}
+	if s.Token == "" {
+		return errors.New("启用API时 api.token 不能为空")
+	}
+	host, _, err := net.SplitHostPort(s.Address)
+	if err != nil {
+		return fmt.Errorf("api.address 格式错误: %v", err)
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return fmt.Errorf("api.address 只能监听本机地址, 不能是 %s", host)
+	}
+	return nil
+}
+
+// @title: NewAPIToken
+// @description: 生成随机的访问令牌
+// @return: string
+func NewAPIToken() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// @title: GameStatus
+// @description: 游戏和备份状态
+type GameStatus struct {
+	Running    bool    `json:"running"`
+	GameUI     GameUI  `json:"game_ui"`
+	GameUIName string  `json:"game_ui_name"`
+	Music      MusicID `json:"music"`
+	MusicName  string  `json:"music_name,omitempty"`
+	DataDir    string  `json:"data_dir"`
+	Backups    int     `json:"backups"`
+	Latest     string  `json:"latest,omitempty"`
+	Board      *Board  `json:"board,omitempty"`
+}
+
+// @title: CurrentStatus
+// @description: 读取当前的游戏和备份状态
+// @return: GameStatus
+func CurrentStatus() GameStatus {
+	status := GameStatus{GameUI: GameUIUnavailable, Music: -1, DataDir: data_path}
+	status.Running = AttachGame()
+	if status.Running && pvz.IsValid() {
+		status.GameUI = pvz.GetGameUI()
+		status.Music = pvz.GetMusicID()
+		status.MusicName = status.Music.String()
+		status.Board, _ = ReadBoard(pvz)
+	}
+	status.GameUIName = status.GameUI.String()
+	if backups, err := ListBackups(); err == nil {
+		status.Backups = len(backups)
+		if len(backups) > 0 {
+			status.Latest = backups[0].Name
+		}
+	}
+	return status
+}
+
+// @title: APIBackend
+// @description: API使用的操作, 测试时可以替换为假实现
+type APIBackend interface {
+	Status() GameStatus
+	Backups() ([]BackupInfo, error)
+	// 立即备份, 返回备份名
+	Backup(label, note string, tags []string) (string, error)
+	// 恢复备份, 备份名为空时恢复最新的备份, 返回恢复的备份名
+	Restore(name string) (string, error)
+}
+
+// localBackend 操作本机的游戏和备份
+type localBackend struct{}
+
+func (localBackend) Status() GameStatus {
+	return CurrentStatus()
+}
+
+func (localBackend) Backups() ([]BackupInfo, error) {
+	return ListBackups()
+}
+
+func (localBackend) Backup(label, note string, tags []string) (string, error) {
+	return ManualBackup(label, note, tags)
+}
+
+func (localBackend) Restore(name string) (string, error) {
+	if name == "" {
+		return RestoreLatest()
+	}
+	if !validBackupName(name) {
+		return "", fmt.Errorf("备份名 %s 不合法", name)
+	}
+	if !CanRestore() {
+		return "", errors.New("请先退出关卡再恢复存档！")
+	}
+	return name, RestoreBackup(name)
+}
+
+// @title: APIServer
+// @description: 本地HTTP API, 所有请求需要带上令牌
+type APIServer struct {
+	backend APIBackend
+	events  *EventBus
+	token   string
+	mux     *http.ServeMux
+}
+
+// @title: NewAPIServer
+// @description: 创建本地HTTP API
+// @param: backend APIBackend 操作
+// @param: events *EventBus 推送给客户端的事件
+// @param: token string 访问令牌
+// @return: *APIServer
+func NewAPIServer(backend APIBackend, events *EventBus, token string) *APIServer {
+	s := &APIServer{backend: backend, events: events, token: token, mux: http.NewServeMux()}
+	s.mux.HandleFunc("/api/status", s.handleStatus)
+	s.mux.HandleFunc("/api/backups", s.handleBackups)
+	s.mux.HandleFunc("/api/restore", s.handleRestore)
+	s.mux.HandleFunc("/api/events", s.handleEvents)
+	return s
+}
+
+// ServeHTTP 检查令牌后分发请求
+// 令牌可以放在 Authorization: Bearer 头中, 浏览器的EventSource无法设置请求头, 也可以使用token参数
+func (s *APIServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		token = strings.TrimPrefix(auth, "Bearer ")
+	}
+	if s.token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+		writeAPIError(w, http.StatusUnauthorized, errors.New("令牌错误"))
+		return
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+// handleStatus GET /api/status
+func (s *APIServer) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAPIError(w, http.StatusMethodNotAllowed, errors.New("只支持GET"))
+		return
+	}
+	writeAPIResult(w, http.StatusOK, s.backend.Status())
+}
+
+// handleBackups GET /api/backups?search= 列出备份, POST /api/backups 立即备份
+func (s *APIServer) handleBackups(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		backups, err := s.backend.Backups()
+		if err != nil {
+			writeAPIError(w, http.StatusInternalServerError, err)
+			return
+		}
+		if query := r.URL.Query().Get("search"); query != "" {
+			backups = FilterBackups(backups, query)
+		}
+		writeAPIResult(w, http.StatusOK, backups)
+	case http.MethodPost:
+		var req struct {
+			Name string   `json:"name"`
+			Note string   `json:"note"`
+			Tags []string `json:"tags"`
+		}
+		if err := readAPIRequest(r, &req); err != nil {
+			writeAPIError(w, http.StatusBadRequest, err)
+			return
+		}
+		name, err := s.backend.Backup(req.Name, req.Note, req.Tags)
+		if err != nil {
+			writeAPIError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeAPIResult(w, http.StatusCreated, map[string]string{"name": name})
+	default:
+		writeAPIError(w, http.StatusMethodNotAllowed, errors.New("只支持GET和POST"))
+	}
+}
+
+// handleRestore POST /api/restore 恢复备份, 不指定备份名时恢复最新的备份
+func (s *APIServer) handleRestore(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeAPIError(w, http.StatusMethodNotAllowed, errors.New("只支持POST"))
+		return
+	}
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := readAPIRequest(r, &req); err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+	name, err := s.backend.Restore(req.Name)
+	if err != nil {
+		writeAPIError(w, http.StatusConflict, err)
+		return
+	}
+	writeAPIResult(w, http.StatusOK, map[string]string{"restored": name})
+}
+
+// handleEvents GET /api/events 以Server-Sent Events推送游戏事件
+func (s *APIServer) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAPIError(w, http.StatusMethodNotAllowed, errors.New("只支持GET"))
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeAPIError(w, http.StatusInternalServerError, errors.New("不支持推送"))
+		return
+	}
+	events, unsubscribe := s.events.Subscribe(64)
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ticker := time.NewTicker(apiKeepAliveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+			fmt.Fprint(w, ": ping\n\n")
+		case e := <-events:
+			data, err := json.Marshal(e)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data)
+		}
+		flusher.Flush()
+	}
+}
+
+// readAPIRequest 读取JSON请求体, 请求体为空时使用默认值
+func readAPIRequest(r *http.Request, v interface{}) error {
+	if r.Body == nil || r.ContentLength == 0 {
+		return nil
+	}
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		return fmt.Errorf("请求格式错误: %v", err)
+	}
+	return nil
+}
+
+// writeAPIResult 输出JSON结果
+func writeAPIResult(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeAPIError 输出错误, 格式与命令行的 -json 输出相同
+func writeAPIError(w http.ResponseWriter, status int, err error) {
+	writeAPIResult(w, status, map[string]string{"error": err.Error()})
+}
+
+// @title: APIService
+// @description: 按设置启动和停止本地HTTP API
+type APIService struct {
+	lock     sync.Mutex
+	server   *http.Server
+	settings APISettings
+}
+
+var api_service = &APIService{}
+
+// @title: APIService::Apply
+// @description: 应用API设置, 设置变化时重新启动
+// @param: s APISettings 设置
+// @return: error
+func (a *APIService) Apply(s APISettings) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if a.server != nil && s == a.settings {
+		return nil
+	}
+	a.stop()
+	a.settings = s
+	if !s.Enabled {
+		return nil
+	}
+	if err := s.Validate(); err != nil {
+		return err
+	}
+	// 先监听端口, 端口被占用时直接返回错误
+	l, err := net.Listen("tcp", s.Address)
+	if err != nil {
+		return err
+	}
+	server := &http.Server{Handler: NewAPIServer(localBackend{}, game_events, s.Token)}
+	a.server = server
+	go server.Serve(l)
+	return nil
+}
+
+// @title: APIService::Close
+// @description: 停止本地HTTP API
+func (a *APIService) Close() {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.stop()
+}
+
+func (a *APIService) stop() {
+	if a.server != nil {
+		a.server.Close()
+		a.server = nil
+	}
+}
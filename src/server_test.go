@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testAPIToken = "secret"
+
+// fakeBackend 不连接游戏的APIBackend
+type fakeBackend struct {
+	backups []BackupInfo
+	// 在关卡中时不能恢复
+	in_level bool
+	restored []string
+}
+
+func (b *fakeBackend) Status() GameStatus {
+	return GameStatus{Running: true, GameUI: GameUIPlaying, GameUIName: GameUIPlaying.String(), Backups: len(b.backups)}
+}
+
+func (b *fakeBackend) Backups() ([]BackupInfo, error) {
+	return b.backups, nil
+}
+
+func (b *fakeBackend) Backup(label, note string, tags []string) (string, error) {
+	if label == "" {
+		return "", errors.New("备份名不能为空")
+	}
+	b.backups = append([]BackupInfo{{Name: label, Note: note, Tags: tags}}, b.backups...)
+	return label, nil
+}
+
+func (b *fakeBackend) Restore(name string) (string, error) {
+	if b.in_level {
+		return "", errors.New("请先退出关卡再恢复存档！")
+	}
+	if name == "" && len(b.backups) > 0 {
+		name = b.backups[0].Name
+	}
+	for _, info := range b.backups {
+		if info.Name == name {
+			b.restored = append(b.restored, name)
+			return name, nil
+		}
+	}
+	return "", errors.New("备份不存在")
+}
+
+func newTestAPI() (*APIServer, *fakeBackend, *EventBus) {
+	backend := &fakeBackend{backups: []BackupInfo{{Name: "b2", Tags: []string{"boss"}}, {Name: "b1"}}}
+	events := NewEventBus()
+	return NewAPIServer(backend, events, testAPIToken), backend, events
+}
+
+// apiRequest 发送带令牌的请求, 返回状态码和解析后的JSON
+func apiRequest(t *testing.T, s http.Handler, method, target, body string) (int, map[string]interface{}) {
+	t.Helper()
+	var r *http.Request
+	if body == "" {
+		r = httptest.NewRequest(method, target, nil)
+	} else {
+		r = httptest.NewRequest(method, target, strings.NewReader(body))
+	}
+	r.Header.Set("Authorization", "Bearer "+testAPIToken)
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	result := map[string]interface{}{}
+	json.Unmarshal(w.Body.Bytes(), &result)
+	return w.Code, result
+}
+
+func TestAPIToken(t *testing.T) {
+	s, _, _ := newTestAPI()
+	for _, r := range []*http.Request{
+		httptest.NewRequest("GET", "/api/status", nil),
+		httptest.NewRequest("GET", "/api/status?token=wrong", nil),
+	} {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("%s: status = %d, want 401", r.URL, w.Code)
+		}
+	}
+	r := httptest.NewRequest("GET", "/api/status", nil)
+	r.Header.Set("Authorization", "Bearer wrong")
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("wrong bearer: status = %d, want 401", w.Code)
+	}
+
+	// 没有设置令牌时拒绝所有请求
+	w = httptest.NewRecorder()
+	NewAPIServer(&fakeBackend{}, NewEventBus(), "").ServeHTTP(w, httptest.NewRequest("GET", "/api/status?token=", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("empty token: status = %d, want 401", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("GET", "/api/status?token="+testAPIToken, nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("query token: status = %d, want 200", w.Code)
+	}
+}
+
+func TestAPIStatus(t *testing.T) {
+	s, _, _ := newTestAPI()
+	code, result := apiRequest(t, s, "GET", "/api/status", "")
+	if code != http.StatusOK || result["running"] != true || result["backups"] != float64(2) {
+		t.Fatalf("status = %d %v", code, result)
+	}
+	if code, _ := apiRequest(t, s, "POST", "/api/status", ""); code != http.StatusMethodNotAllowed {
+		t.Fatalf("POST status = %d, want 405", code)
+	}
+}
+
+func TestAPIBackups(t *testing.T) {
+	s, backend, _ := newTestAPI()
+
+	r := httptest.NewRequest("GET", "/api/backups?search=%23boss", nil)
+	r.Header.Set("Authorization", "Bearer "+testAPIToken)
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	var backups []BackupInfo
+	if err := json.Unmarshal(w.Body.Bytes(), &backups); err != nil || len(backups) != 1 || backups[0].Name != "b2" {
+		t.Fatalf("search = %s", w.Body.String())
+	}
+
+	code, result := apiRequest(t, s, "POST", "/api/backups", `{"name":"b3","note":"before boss","tags":["boss"]}`)
+	if code != http.StatusCreated || result["name"] != "b3" {
+		t.Fatalf("backup = %d %v", code, result)
+	}
+	if len(backend.backups) != 3 || backend.backups[0].Note != "before boss" {
+		t.Fatalf("backups = %+v", backend.backups)
+	}
+	if code, result := apiRequest(t, s, "POST", "/api/backups", `{"name":`); code != http.StatusBadRequest || result["error"] == nil {
+		t.Fatalf("bad request = %d %v", code, result)
+	}
+	if code, result := apiRequest(t, s, "POST", "/api/backups", `{}`); code != http.StatusInternalServerError || result["error"] == nil {
+		t.Fatalf("failed backup = %d %v", code, result)
+	}
+}
+
+func TestAPIRestore(t *testing.T) {
+	s, backend, _ := newTestAPI()
+
+	if code, result := apiRequest(t, s, "POST", "/api/restore", ""); code != http.StatusOK || result["restored"] != "b2" {
+		t.Fatalf("restore latest = %d %v", code, result)
+	}
+	if code, result := apiRequest(t, s, "POST", "/api/restore", `{"name":"b1"}`); code != http.StatusOK || result["restored"] != "b1" {
+		t.Fatalf("restore b1 = %d %v", code, result)
+	}
+	if code, result := apiRequest(t, s, "POST", "/api/restore", `{"name":"missing"}`); code != http.StatusConflict || result["error"] == nil {
+		t.Fatalf("restore missing = %d %v", code, result)
+	}
+	if code, _ := apiRequest(t, s, "POST", "/api/restore", `not json`); code != http.StatusBadRequest {
+		t.Fatalf("restore bad request = %d", code)
+	}
+	if code, _ := apiRequest(t, s, "GET", "/api/restore", ""); code != http.StatusMethodNotAllowed {
+		t.Fatalf("GET restore = %d", code)
+	}
+	backend.in_level = true
+	if code, result := apiRequest(t, s, "POST", "/api/restore", `{"name":"b1"}`); code != http.StatusConflict || result["error"] == nil {
+		t.Fatalf("restore in level = %d %v", code, result)
+	}
+	if strings.Join(backend.restored, ",") != "b2,b1" {
+		t.Fatalf("restored = %v", backend.restored)
+	}
+}
+
+func TestAPIEvents(t *testing.T) {
+	s, _, events := newTestAPI()
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/api/events?token=" + testAPIToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("events = %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	// 收到响应头时已经订阅
+	events.Publish(NewGameEvent(EventBackup, map[string]interface{}{"name": "b3"}))
+
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+	}()
+	want := []string{"event: " + EventBackup, "data: "}
+	for _, prefix := range want {
+		select {
+		case line := <-lines:
+			if !strings.HasPrefix(line, prefix) {
+				t.Fatalf("line = %q, want prefix %q", line, prefix)
+			}
+			if strings.HasPrefix(line, "data: ") {
+				var e GameEvent
+				if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &e); err != nil || e.Type != EventBackup || e.Data["name"] != "b3" {
+					t.Fatalf("data = %q", line)
+				}
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("timed out waiting for event")
+		}
+	}
+}
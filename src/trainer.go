@@ -0,0 +1,161 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// 修改器开关
+const (
+	TrainerInfiniteSun  = "infinite_sun"  // 种植不消耗阳光
+	TrainerNoCooldown   = "no_cooldown"   // 卡片无冷却
+	TrainerFreePlanting = "free_planting" // 阳光不足也能种植
+	TrainerAutoCollect  = "auto_collect"  // 自动收集阳光和金币
+	TrainerPauseSpawn   = "pause_spawn"   // 暂停出怪
+)
+
+// 最大阳光
+const maxSun = 9990
+
+// @title: TrainerToggle
+// @description: 修改器开关
+type TrainerToggle struct {
+	Name  string
+	Label string
+}
+
+// 所有开关, 按界面中的顺序
+var trainerToggles = []TrainerToggle{
+	{TrainerInfiniteSun, "infinite sun"},
+	{TrainerNoCooldown, "no cooldown"},
+	{TrainerFreePlanting, "free planting"},
+	{TrainerAutoCollect, "auto collect"},
+	{TrainerPauseSpawn, "pause spawning"},
+}
+
+// 游戏代码补丁, 地址适用于1.0.0.1051及基于它的杂交版
+var patches = NewPatchManager(pvz)
+
+func init() {
+	patches.Register(TrainerInfiniteSun,
+		Patch{Address: 0x41BA74, Original: []byte{0x2B}, Patched: []byte{0x3B}},
+		Patch{Address: 0x41BAC0, Original: []byte{0x9E}, Patched: []byte{0x91}},
+	)
+	patches.Register(TrainerNoCooldown,
+		Patch{Address: 0x487296, Original: []byte{0x7E}, Patched: []byte{0x70}},
+	)
+	patches.Register(TrainerFreePlanting,
+		Patch{Address: 0x41BA72, Original: []byte{0x7F}, Patched: []byte{0x70}},
+	)
+	patches.Register(TrainerAutoCollect,
+		Patch{Address: 0x43158F, Original: []byte{0x75}, Patched: []byte{0xEB}},
+	)
+	patches.Register(TrainerPauseSpawn,
+		Patch{Address: 0x4265DC, Original: []byte{0x74}, Patched: []byte{0xEB}},
+	)
+}
+
+// @title: SetSun
+// @description: 设置阳光, 只能在关卡中使用
+// @param: m WritableMemory 游戏内存
+// @param: sun int 阳光
+// @return: error
+func SetSun(m WritableMemory, sun int) error {
+	if sun < 0 || sun > maxSun {
+		return fmt.Errorf("阳光必须在0到%d之间", maxSun)
+	}
+	if _, err := ReadBoard(m); err != nil {
+		return err
+	}
+	return m.WriteBytes(ToBytes(int32(sun)), lawnAppBase, lawnAppBoardOffset, boardSunOffset)
+}
+
+// @title: SetTrainerToggle
+// @description: 打开或关闭修改器开关
+// @param: name string 开关名
+// @param: enabled bool
+// @return: error
+func SetTrainerToggle(name string, enabled bool) error {
+	if !pvz.IsValid() {
+		return errors.New("游戏未运行")
+	}
+	return patches.Set(name, enabled)
+}
+
+// @title: TrainerToggleEnabled
+// @description: 开关是否打开, 直接读取游戏内存, 游戏重启后为关闭
+// @param: name string 开关名
+// @return: bool
+func TrainerToggleEnabled(name string) bool {
+	if !pvz.IsValid() {
+		return false
+	}
+	state, err := patches.State(name)
+	return err == nil && state == PatchApplied
+}
+
+// @title: NewTrainerTab
+// @description: 修改器页
+// @param: w fyne.Window 父窗口
+// @return: fyne.CanvasObject, func() 监测游戏状态时刷新开关
+func NewTrainerTab(w fyne.Window) (fyne.CanvasObject, func()) {
+	sun_entry := widget.NewEntry()
+	sun_entry.SetPlaceHolder("0-9990")
+	sun_button := widget.NewButton("set sun", func() {
+		sun, err := strconv.Atoi(sun_entry.Text)
+		if err != nil {
+			dialog.NewInformation("Error", "Sun must be a number.", w).Show()
+			return
+		}
+		if err := SetSun(pvz, sun); err != nil {
+			dialog.NewInformation("Error", err.Error(), w).Show()
+		}
+	})
+
+	checks := map[string]*widget.Check{}
+	items := []fyne.CanvasObject{}
+	for _, toggle := range trainerToggles {
+		name := toggle.Name
+		check := widget.NewCheck(toggle.Label, nil)
+		check.OnChanged = func(b bool) {
+			if b == TrainerToggleEnabled(name) {
+				return
+			}
+			if err := SetTrainerToggle(name, b); err != nil {
+				check.SetChecked(!b)
+				dialog.NewInformation("Error", err.Error(), w).Show()
+			}
+		}
+		checks[name] = check
+		items = append(items, check)
+	}
+
+	refresh := func() {
+		running := pvz.IsValid()
+		for name, check := range checks {
+			check.SetChecked(TrainerToggleEnabled(name))
+			if running {
+				check.Enable()
+			} else {
+				check.Disable()
+			}
+		}
+	}
+	refresh()
+
+	return container.NewVBox(
+		container.NewBorder(nil, nil, nil, sun_button, sun_entry),
+		container.NewGridWithColumns(2, items...),
+		widget.NewLabel("Toggles are reset when the game restarts."),
+		container.NewGridWithColumns(2,
+			widget.NewButton("load scenario", func() { ShowLoadScenario(w) }),
+			widget.NewButton("export scenario", func() { ShowExportScenario(w) }),
+		),
+	), refresh
+}
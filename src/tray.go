@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"log"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/driver/desktop"
+)
+
+// @title: SetupTray
+// @description: 添加托盘图标和菜单, 开启最小化到托盘时关闭窗口只会隐藏
+// @param: a fyne.App
+// @param: w fyne.Window 主窗口
+// @return: func(Config) 配置变化时刷新菜单, 不支持托盘时为空操作
+func SetupTray(a fyne.App, w fyne.Window) func(Config) {
+	desk, ok := a.(desktop.App)
+	if !ok {
+		return func(Config) {}
+	}
+
+	auto_save_item := fyne.NewMenuItem("Auto save", func() {
+		if err := UpdateConfig(func(c *Config) { c.AutoSave = !c.AutoSave }); err != nil {
+			log.Println(err)
+		}
+	})
+	show_item := fyne.NewMenuItem("Show window", func() {
+		w.Show()
+		w.RequestFocus()
+	})
+	menu := fyne.NewMenu("pvzHE utils",
+		show_item,
+		fyne.NewMenuItemSeparator(),
+		auto_save_item,
+		fyne.NewMenuItem("Backup now", func() {
+			if _, err := ManualBackup("", "", nil); err != nil {
+				showTrayError(w, err)
+			}
+		}),
+		fyne.NewMenuItem("Restore latest", func() {
+			if _, err := RestoreLatest(); err != nil {
+				showTrayError(w, err)
+			}
+		}),
+		fyne.NewMenuItem("Open backup folder", func() {
+			MakeDir(backup_path)
+			if err := OpenFolder(backup_path); err != nil {
+				showTrayError(w, err)
+			}
+		}),
+	)
+	desk.SetSystemTrayMenu(menu)
+
+	refresh := func(c Config) {
+		auto_save_item.Checked = c.AutoSave
+		menu.Refresh()
+		if c.MinimizeToTray {
+			w.SetCloseIntercept(w.Hide)
+		} else {
+			w.SetCloseIntercept(a.Quit)
+		}
+	}
+	refresh(CurrentConfig())
+	return refresh
+}
+
+// showTrayError 托盘操作失败时显示窗口并提示
+func showTrayError(w fyne.Window, err error) {
+	w.Show()
+	dialog.NewInformation("Error", err.Error(), w).Show()
+}
+
+// @title: RestoreLatest
+// @description: 恢复最新的备份
+// @return: string 恢复的备份名, error
+func RestoreLatest() (string, error) {
+	if !CanRestore() {
+		return "", errors.New("请先退出关卡再恢复存档！")
+	}
+	backups, err := ListBackups()
+	if err != nil {
+		return "", err
+	}
+	if len(backups) == 0 {
+		return "", errors.New("没有备份")
+	}
+	return backups[0].Name, RestoreBackup(backups[0].Name)
+}
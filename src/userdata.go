@@ -0,0 +1,396 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+)
+
+// 存档文件版本, 与游戏写入时的版本号一致
+const (
+	UsersFileVersion = 14 // users.dat
+	UserDataVersion  = 12 // userN.dat
+	// 有成就的userN.dat, 禅境花园之后是成就
+	UserDataAchievementsVersion = 13
+)
+
+const (
+	userChallengeCount   = 100  // 各模式的记录数
+	userPurchaseCount    = 80   // 商店购买记录数
+	pottedPlantSize      = 0x58 // 禅境花园中单个植物的字节数
+	userAchievementCount = 20   // 成就数
+)
+
+// 可以在商店购买的植物, 下标即为购买记录中的位置
+var purchasePlantNames = []string{
+	"Gatling Pea", "Twin Sunflower", "Gloom-shroom", "Cattail", "Winter Melon",
+	"Gold Magnet", "Spikerock", "Cob Cannon", "Imitater",
+}
+
+// 成就名称, 下标即为成就在存档中的位置
+var achievementNames = []string{
+	"Home Lawn Security", "Nobel Peas Prize", "Better Off Dead", "China Shop", "SPUDOW!",
+	"Explodonator", "Morticulturalist", "Don't Pea in the Pool", "Roll Some Heads", "Grounded",
+	"Zombologist", "Penny Pincher", "Sunny Days", "Popcorn Party", "Good Morning",
+	"No Fungus Among Us", "Beyond the Grave", "Immortal", "Towering Wisdom", "Mustache Mode",
+}
+
+// @title: UsersFile
+// @description: 用户列表(users.dat)
+type UsersFile struct {
+	// 版本
+	Version int32
+	// 用户
+	Users []UserEntry
+}
+
+// @title: UserEntry
+// @description: 用户列表中的一个用户, 对应存档为 user{ID}.dat
+type UserEntry struct {
+	// 用户名
+	Name string
+	// 最近使用序号, 越大越近
+	UseSeq int32
+	// 用户ID
+	ID int32
+}
+
+// @title: PottedPlant
+// @description: 禅境花园中的植物
+type PottedPlant struct {
+	// 植物类型
+	SeedType PlantType
+	// 所在花园
+	Garden int32
+	// 所在位置
+	X int32
+	Y int32
+	// 成长阶段
+	Age int32
+	// 朝向
+	Facing int32
+	// 浇水/施肥时间等其余字段, 原样保留
+	Rest [pottedPlantSize - 6*4]byte
+}
+
+// @title: UserData
+// @description: 用户存档(userN.dat)
+type UserData struct {
+	// 版本
+	Version int32
+	// 冒险模式关卡序号
+	Level int32
+	// 金币, 为显示值的1/10
+	Coins int32
+	// 冒险模式通关次数
+	FinishedAdventure int32
+	// 各模式的记录, 下标对应的游戏模式为下标+1, 大于0表示已完成(生存模式为通过的轮数)
+	ChallengeRecords [userChallengeCount]int32
+	// 商店购买记录
+	Purchases [userPurchaseCount]int32
+	// 游戏时长
+	PlayTimeActive   int32
+	PlayTimeInactive int32
+	// 各种标记
+	HasUsedCheatKeys           int32
+	HasWokenStinky             int32
+	DidntPurchasePacketUpgrade int32
+	LastStinkyChocolateTime    int32
+	StinkyPosX                 int32
+	StinkyPosY                 int32
+	HasUnlockedMinigames       int32
+	HasUnlockedPuzzleMode      int32
+	HasNewMinigame             int32
+	HasNewScaryPotter          int32
+	HasNewIZombie              int32
+	HasNewSurvival             int32
+	HasUnlockedSurvivalMode    int32
+	NeedsMessageOnGameSelector int32
+	NeedsMagicTacoReward       int32
+	HasSeenStinky              int32
+	HasSeenUpsell              int32
+	PlaceHolderPlayerStats     int32
+	// 禅境花园
+	PottedPlants []PottedPlant
+	// 成就, 每个成就1字节, 版本没有成就时为空
+	Achievements []bool
+	// 未解析的剩余数据, 原样保留
+	Tail []byte
+}
+
+// dataReader 按游戏存档的格式(小端)顺序读取数据
+type dataReader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (r *dataReader) read(n int) []byte {
+	if r.err != nil {
+		return make([]byte, n)
+	}
+	if n < 0 || r.pos+n > len(r.data) {
+		r.err = fmt.Errorf("存档在 0x%X 处长度不足", r.pos)
+		return make([]byte, n)
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b
+}
+
+func (r *dataReader) Long() int32 {
+	return int32(binary.LittleEndian.Uint32(r.read(4)))
+}
+
+func (r *dataReader) Short() int16 {
+	return int16(binary.LittleEndian.Uint16(r.read(2)))
+}
+
+func (r *dataReader) Str() string {
+	n := int(uint16(r.Short()))
+	return string(r.read(n))
+}
+
+func (r *dataReader) Rest() []byte {
+	if r.err != nil {
+		return nil
+	}
+	b := append([]byte{}, r.data[r.pos:]...)
+	r.pos = len(r.data)
+	return b
+}
+
+// dataWriter 按游戏存档的格式(小端)顺序写入数据
+type dataWriter struct {
+	bytes.Buffer
+}
+
+func (w *dataWriter) Long(v int32) {
+	binary.Write(&w.Buffer, binary.LittleEndian, v)
+}
+
+func (w *dataWriter) Short(v int16) {
+	binary.Write(&w.Buffer, binary.LittleEndian, v)
+}
+
+func (w *dataWriter) Str(s string) {
+	w.Short(int16(len(s)))
+	w.WriteString(s)
+}
+
+// @title: ParseUsersFile
+// @description: 解析用户列表
+// @param: data []byte 文件内容
+// @return: *UsersFile, error
+func ParseUsersFile(data []byte) (*UsersFile, error) {
+	r := &dataReader{data: data}
+	f := &UsersFile{Version: r.Long()}
+	count := int(r.Short())
+	for i := 0; i < count && r.err == nil; i++ {
+		f.Users = append(f.Users, UserEntry{Name: r.Str(), UseSeq: r.Long(), ID: r.Long()})
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	if r.pos != len(data) {
+		return nil, fmt.Errorf("用户列表末尾有 %d 字节多余数据", len(data)-r.pos)
+	}
+	return f, nil
+}
+
+// @title: UsersFile::Encode
+// @description: 编码用户列表
+// @return: []byte
+func (f *UsersFile) Encode() []byte {
+	w := &dataWriter{}
+	w.Long(f.Version)
+	w.Short(int16(len(f.Users)))
+	for _, u := range f.Users {
+		w.Str(u.Name)
+		w.Long(u.UseSeq)
+		w.Long(u.ID)
+	}
+	return w.Bytes()
+}
+
+// @title: ParseUserData
+// @description: 解析用户存档
+// @param: data []byte 文件内容
+// @return: *UserData, error
+func ParseUserData(data []byte) (*UserData, error) {
+	r := &dataReader{data: data}
+	u := &UserData{}
+	u.Version = r.Long()
+	if r.err == nil && u.Version != UserDataVersion && u.Version != UserDataAchievementsVersion {
+		return nil, fmt.Errorf("不支持的用户存档版本 %d", u.Version)
+	}
+	u.Level = r.Long()
+	u.Coins = r.Long()
+	u.FinishedAdventure = r.Long()
+	for i := range u.ChallengeRecords {
+		u.ChallengeRecords[i] = r.Long()
+	}
+	for i := range u.Purchases {
+		u.Purchases[i] = r.Long()
+	}
+	for _, field := range u.flags() {
+		*field = r.Long()
+	}
+
+	count := r.Long()
+	if count < 0 || int(count)*pottedPlantSize > len(data)-r.pos {
+		if r.err == nil {
+			r.err = fmt.Errorf("禅境花园植物数量 %d 不正确", count)
+		}
+	}
+	for i := 0; i < int(count) && r.err == nil; i++ {
+		p := PottedPlant{
+			SeedType: PlantType(r.Long()),
+			Garden:   r.Long(),
+			X:        r.Long(),
+			Y:        r.Long(),
+			Age:      r.Long(),
+			Facing:   r.Long(),
+		}
+		copy(p.Rest[:], r.read(len(p.Rest)))
+		u.PottedPlants = append(u.PottedPlants, p)
+	}
+	if u.HasAchievements() {
+		u.Achievements = make([]bool, userAchievementCount)
+		for i, b := range r.read(userAchievementCount) {
+			u.Achievements[i] = b != 0
+		}
+	}
+	u.Tail = r.Rest()
+
+	if r.err != nil {
+		return nil, r.err
+	}
+	return u, nil
+}
+
+// @title: UserData::Encode
+// @description: 编码用户存档
+// @return: []byte
+func (u *UserData) Encode() []byte {
+	w := &dataWriter{}
+	w.Long(u.Version)
+	w.Long(u.Level)
+	w.Long(u.Coins)
+	w.Long(u.FinishedAdventure)
+	for _, v := range u.ChallengeRecords {
+		w.Long(v)
+	}
+	for _, v := range u.Purchases {
+		w.Long(v)
+	}
+	for _, field := range u.flags() {
+		w.Long(*field)
+	}
+	w.Long(int32(len(u.PottedPlants)))
+	for _, p := range u.PottedPlants {
+		w.Long(int32(p.SeedType))
+		w.Long(p.Garden)
+		w.Long(p.X)
+		w.Long(p.Y)
+		w.Long(p.Age)
+		w.Long(p.Facing)
+		w.Write(p.Rest[:])
+	}
+	if u.HasAchievements() {
+		for i := 0; i < userAchievementCount; i++ {
+			if u.AchievementEarned(i) {
+				w.WriteByte(1)
+			} else {
+				w.WriteByte(0)
+			}
+		}
+	}
+	w.Write(u.Tail)
+	return w.Bytes()
+}
+
+// flags 购买记录之后、禅境花园之前的字段, 按存档中的顺序排列
+func (u *UserData) flags() []*int32 {
+	return []*int32{
+		&u.PlayTimeActive, &u.PlayTimeInactive,
+		&u.HasUsedCheatKeys, &u.HasWokenStinky, &u.DidntPurchasePacketUpgrade,
+		&u.LastStinkyChocolateTime, &u.StinkyPosX, &u.StinkyPosY,
+		&u.HasUnlockedMinigames, &u.HasUnlockedPuzzleMode,
+		&u.HasNewMinigame, &u.HasNewScaryPotter, &u.HasNewIZombie, &u.HasNewSurvival,
+		&u.HasUnlockedSurvivalMode, &u.NeedsMessageOnGameSelector, &u.NeedsMagicTacoReward,
+		&u.HasSeenStinky, &u.HasSeenUpsell, &u.PlaceHolderPlayerStats,
+	}
+}
+
+// @title: UserData::AdventureLevel
+// @description: 冒险模式关卡, 格式为 大关-小关
+// @return: string
+func (u *UserData) AdventureLevel() string {
+	if u.Level <= 0 {
+		return "1-1"
+	}
+	return fmt.Sprintf("%d-%d", (u.Level-1)/10+1, (u.Level-1)%10+1)
+}
+
+// @title: UserData::ModeCompleted
+// @description: 判断某个游戏模式(小游戏/解谜/生存)是否已完成
+// @param: mode int 游戏模式
+// @return: bool
+func (u *UserData) ModeCompleted(mode int) bool {
+	if mode < 1 || mode > userChallengeCount {
+		return false
+	}
+	return u.ChallengeRecords[mode-1] > 0
+}
+
+// @title: UserData::PlantPurchased
+// @description: 判断商店中的植物是否已购买
+// @param: index int 植物在购买记录中的位置, 见 purchasePlantNames
+// @return: bool
+func (u *UserData) PlantPurchased(index int) bool {
+	if index < 0 || index >= len(purchasePlantNames) {
+		return false
+	}
+	return u.Purchases[index] > 0
+}
+
+// @title: UserData::HasAchievements
+// @description: 存档版本是否保存成就
+// @return: bool
+func (u *UserData) HasAchievements() bool {
+	return u.Version == UserDataAchievementsVersion
+}
+
+// @title: UserData::AchievementEarned
+// @description: 判断是否获得了成就
+// @param: index int 成就的位置, 见 achievementNames
+// @return: bool
+func (u *UserData) AchievementEarned(index int) bool {
+	return index >= 0 && index < len(u.Achievements) && u.Achievements[index]
+}
+
+// @title: LoadUserData
+// @description: 读取并解析用户存档文件
+// @param: path string 文件路径
+// @return: *UserData, error
+func LoadUserData(path string) (*UserData, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseUserData(data)
+}
+
+// @title: LoadUsersFile
+// @description: 读取并解析用户列表文件
+// @param: path string 文件路径
+// @return: *UsersFile, error
+func LoadUsersFile(path string) (*UsersFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseUsersFile(data)
+}
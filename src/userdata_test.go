@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func readTestData(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestUsersFileRoundTrip(t *testing.T) {
+	data := readTestData(t, "users.dat")
+	f, err := ParseUsersFile(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []UserEntry{{Name: "player", UseSeq: 3, ID: 1}, {Name: "guest", UseSeq: 2, ID: 2}}
+	if f.Version != UsersFileVersion || !reflect.DeepEqual(f.Users, want) {
+		t.Fatalf("users = %+v", f)
+	}
+	if !bytes.Equal(f.Encode(), data) {
+		t.Fatal("encoded users.dat differs from the original")
+	}
+	if _, err := ParseUsersFile(data[:len(data)-1]); err == nil {
+		t.Fatal("expected error for a truncated file")
+	}
+}
+
+func TestUserDataRoundTrip(t *testing.T) {
+	data := readTestData(t, "user1.dat")
+	u, err := ParseUserData(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Version != UserDataAchievementsVersion || u.AdventureLevel() != "4-5" || u.Coins != 2500 || u.PlayTimeActive != 36000 {
+		t.Fatalf("user = %+v", u)
+	}
+	if !u.ModeCompleted(1) || !u.ModeCompleted(16) || u.ModeCompleted(2) || u.ChallengeRecords[50] != 3 {
+		t.Fatalf("records = %v", u.ChallengeRecords)
+	}
+	if !u.PlantPurchased(0) || !u.PlantPurchased(1) || u.PlantPurchased(2) {
+		t.Fatalf("purchases = %v", u.Purchases)
+	}
+	if u.HasUnlockedMinigames != 1 || u.HasUnlockedPuzzleMode != 1 || u.HasUnlockedSurvivalMode != 1 {
+		t.Fatalf("flags = %+v", u)
+	}
+	if len(u.PottedPlants) != 2 || u.PottedPlants[1].SeedType != 1 || u.PottedPlants[1].Garden != 1 || u.PottedPlants[1].X != 3 {
+		t.Fatalf("potted plants = %+v", u.PottedPlants)
+	}
+	earned := []int{}
+	for i := range achievementNames {
+		if u.AchievementEarned(i) {
+			earned = append(earned, i)
+		}
+	}
+	if !reflect.DeepEqual(earned, []int{0, 1, 3}) || len(u.Tail) != 0 {
+		t.Fatalf("achievements = %v, tail = %v", earned, u.Tail)
+	}
+	if !bytes.Equal(u.Encode(), data) {
+		t.Fatal("encoded user1.dat differs from the original")
+	}
+
+	// 修改成就后重新解析
+	u.Achievements[2] = true
+	again, err := ParseUserData(u.Encode())
+	if err != nil || !again.AchievementEarned(2) {
+		t.Fatalf("achievement not saved: %v", err)
+	}
+}
+
+func TestUserDataWithoutAchievements(t *testing.T) {
+	data := readTestData(t, "user2.dat")
+	u, err := ParseUserData(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 这个版本没有成就, 末尾的数据原样保留
+	if u.HasAchievements() || u.Achievements != nil || !bytes.Equal(u.Tail, []byte{7, 0, 0, 0}) || len(u.PottedPlants) != 0 {
+		t.Fatalf("achievements = %v, tail = %v", u.Achievements, u.Tail)
+	}
+	if !bytes.Equal(u.Encode(), data) {
+		t.Fatal("encoded user2.dat differs from the original")
+	}
+}
+
+func TestDiffUserDataAchievements(t *testing.T) {
+	u, err := ParseUserData(readTestData(t, "user1.dat"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, _ := ParseUserData(u.Encode())
+	other.Achievements[0] = false
+	other.Achievements[19] = true
+	got := diffUserData(u, other)
+	want := []string{"achievement: -Home Lawn Security", "achievement: +Mustache Mode"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("diff = %q", got)
+	}
+}
+
+func TestUserDataVersion(t *testing.T) {
+	data := readTestData(t, "user1.dat")
+	// 有成就的版本缺少成就时不能解析
+	if _, err := ParseUserData(data[:len(data)-userAchievementCount+1]); err == nil {
+		t.Fatal("expected error for missing achievements")
+	}
+	// 同样的内容按没有成就的版本解析, 成就留在末尾
+	old := append([]byte{}, data...)
+	old[0] = UserDataVersion
+	u, err := ParseUserData(old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Achievements != nil || len(u.Tail) != userAchievementCount {
+		t.Fatalf("achievements = %v, tail = %d bytes", u.Achievements, len(u.Tail))
+	}
+	old[0] = 99
+	if _, err := ParseUserData(old); err == nil {
+		t.Fatal("expected error for an unsupported version")
+	}
+}
@@ -1,7 +1,9 @@
 package main
 
 import (
+	"encoding/binary"
 	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
@@ -157,9 +159,17 @@ func CopyFile(src, des string) (written int64, err error) {
 	if err != nil {
 		return 0, err
 	}
-	defer desFile.Close()
 
-	return io.Copy(desFile, srcFile)
+	written, err = io.Copy(desFile, srcFile)
+	if err != nil {
+		desFile.Close()
+		return written, err
+	}
+	if err = desFile.Close(); err != nil {
+		return written, err
+	}
+	//保留源文件的修改时间, 快照中按修改时间判断最近的存档
+	return written, os.Chtimes(des, fi.ModTime(), fi.ModTime())
 }
 
 //使用ioutil.WriteFile()和ioutil.ReadFile()
@@ -304,6 +314,21 @@ func MakeDir(dir string) error {
 	return nil
 }
 
+// @title: FormatSize
+// @description: 将字节数格式化为易读的大小
+// @param: size int64 字节数
+// @return: string
+func FormatSize(size int64) string {
+	switch {
+	case size >= 1024*1024:
+		return fmt.Sprintf("%.1f MB", float64(size)/1024/1024)
+	case size >= 1024:
+		return fmt.Sprintf("%.1f KB", float64(size)/1024)
+	default:
+		return fmt.Sprintf("%d B", size)
+	}
+}
+
 func (pvz *pvzWindow) CallSave() {
 	cd := &Code{
 		page:      256,
@@ -312,8 +337,8 @@ func (pvz *pvzWindow) CallSave() {
 		calls_pos: make([]uint16, 0),
 	}
 
-	asm_mov_exx_dword_ptr(cd, ECX, 0x006A9EC0)
-	asm_mov_exx_dword_ptr_exx_add(cd, ECX, 0x768)
+	asm_mov_exx_dword_ptr(cd, ECX, lawnAppBase)
+	asm_mov_exx_dword_ptr_exx_add(cd, ECX, lawnAppBoardOffset)
 	asm_push_exx(cd, ECX)
 	asm_call(cd, 0x408C30)
 	asm_ret(cd)
@@ -362,6 +387,101 @@ func (pvz *pvzWindow) ReadMemory(readSize int, address ...int) interface{} {
 	return *buffer
 }
 
+// @title: pvzWindow::ReadBytes
+// @description: 读取一段内存, 失败时返回错误而不是panic
+// @param: size int 读取字节数
+// @param: address ...int 内存地址(可以多级偏移)
+// @return: []byte, error
+func (pvz *pvzWindow) ReadBytes(size int, address ...int) ([]byte, error) {
+	if !pvz.IsValid() {
+		return nil, errors.New("窗口无效!")
+	}
+
+	// 加锁
+	pvz.memoryLock <- struct{}{}
+	defer func() {
+		// 解锁
+		<-pvz.memoryLock
+	}()
+
+	target, err := pvz.resolve(address...)
+	if err != nil {
+		return nil, err
+	}
+	buffer := make([]byte, size)
+	if size > 0 && !pvz.readProcess(target, buffer) {
+		return nil, errors.New("读取内存失败!")
+	}
+	return buffer, nil
+}
+
+// @title: pvzWindow::WriteBytes
+// @description: 写入一段内存, 失败时返回错误而不是panic
+// @param: data []byte 要写入的字节
+// @param: address ...int 内存地址(可以多级偏移)
+// @return: error
+func (pvz *pvzWindow) WriteBytes(data []byte, address ...int) error {
+	if !pvz.IsValid() {
+		return errors.New("窗口无效!")
+	}
+
+	// 加锁
+	pvz.memoryLock <- struct{}{}
+	defer func() {
+		// 解锁
+		<-pvz.memoryLock
+	}()
+
+	target, err := pvz.resolve(address...)
+	if err != nil {
+		return err
+	}
+	if len(data) == 0 {
+		return nil
+	}
+	bytesWrite := new(SIZE_T)
+	r1, _, _ := WriteProcessMemoryW.Call(
+		uintptr(pvz.ProcessHandle),
+		uintptr(target),
+		uintptr(unsafe.Pointer(&data[0])),
+		uintptr(len(data)),
+		uintptr(unsafe.Pointer(bytesWrite)),
+	)
+	if r1 == 0 || *bytesWrite != SIZE_T(len(data)) {
+		return errors.New("写入内存失败!")
+	}
+	return nil
+}
+
+// resolve 按多级偏移计算最终地址
+func (pvz *pvzWindow) resolve(address ...int) (uint32, error) {
+	var offset uint32 = 0 // 内存地址
+	for i := 0; i < len(address)-1; i++ {
+		pointer := make([]byte, 4)
+		if !pvz.readProcess(offset+uint32(address[i]), pointer) {
+			return 0, errors.New("读取内存失败!")
+		}
+		offset = binary.LittleEndian.Uint32(pointer)
+		if offset == 0 {
+			return 0, errors.New("空指针!")
+		}
+	}
+	return offset + uint32(address[len(address)-1]), nil
+}
+
+// readProcess 读取进程内存到buffer, 读取失败时返回false
+func (pvz *pvzWindow) readProcess(address uint32, buffer []byte) bool {
+	bytesRead := new(SIZE_T)
+	r1, _, _ := ReadProcessMemoryW.Call(
+		uintptr(pvz.ProcessHandle),
+		uintptr(address),
+		uintptr(unsafe.Pointer(&buffer[0])),
+		uintptr(len(buffer)),
+		uintptr(unsafe.Pointer(bytesRead)),
+	)
+	return r1 != 0 && *bytesRead == SIZE_T(len(buffer))
+}
+
 // @title: pvzWindow::WriteMemory
 // @description: 写入内存
 // @param: writeBuffer []byte 要写入的字节
@@ -423,15 +543,15 @@ func (pvz *pvzWindow) IsValid() bool {
 
 // @title: pvzWindow::GetGameUI
 // @description: 获取游戏界面类型
-// @return: int 1: 主界面, 2: 选卡, 3: 正常游戏/战斗, 4: 僵尸进屋, 7: 模式选择, -1: 不可用
-func (pvz *pvzWindow) GetGameUI() int {
+// @return: GameUI 游戏未运行时为GameUIUnavailable
+func (pvz *pvzWindow) GetGameUI() GameUI {
 	if !pvz.IsValid() {
-		return -1
+		return GameUIUnavailable
 	}
-	return int(pvz.ReadMemory(4, 0x6a9ec0, 0x7FC).(LPVOID))
+	return GameUI(pvz.ReadMemory(4, lawnAppBase, lawnAppGameUIOffset).(LPVOID))
 }
 
-func (pvz *pvzWindow) PlayMusic(id int) {
+func (pvz *pvzWindow) PlayMusic(id MusicID) {
 	if !pvz.IsValid() {
 		log.Panic("窗口无效!")
 	}
@@ -441,18 +561,18 @@ func (pvz *pvzWindow) PlayMusic(id int) {
 		length:    0,
 		calls_pos: make([]uint16, 0),
 	}
-	asm_mov_exx(cd, EDI, id)
-	asm_mov_exx_dword_ptr(cd, EAX, 0x6A9EC0)
-	asm_mov_exx_dword_ptr_exx_add(cd, EAX, 0x83c)
+	asm_mov_exx(cd, EDI, int(id))
+	asm_mov_exx_dword_ptr(cd, EAX, lawnAppBase)
+	asm_mov_exx_dword_ptr_exx_add(cd, EAX, lawnAppMusicOffset)
 	asm_call(cd, 0x0045b750)
 	asm_ret(cd)
 	asm_code_inject(cd, pvz.ProcessHandle)
 
 }
 
-func (pvz *pvzWindow) GetMusicID() int {
+func (pvz *pvzWindow) GetMusicID() MusicID {
 	if !pvz.IsValid() {
 		log.Panic("窗口无效!")
 	}
-	return int(pvz.ReadMemory(4, 0x6a9ec0, 0x83c, 0x8).(LPVOID))
+	return MusicID(pvz.ReadMemory(4, lawnAppBase, lawnAppMusicOffset, musicIDOffset).(LPVOID))
 }